@@ -3,6 +3,7 @@ package app
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 
@@ -23,6 +24,13 @@ func Run(args []string) int {
 	app.HideHelpCommand = true
 
 	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "path to configuration file",
+			EnvVars: []string{
+				sitred.EnvPrefix + "_CONFIG",
+			},
+		},
 		&cli.StringFlag{
 			Name:  "server-pid",
 			Usage: "path to pid file",
@@ -45,7 +53,6 @@ func Run(args []string) int {
 					EnvVars: []string{
 						sitred.EnvPrefix + "_TLS_CERTIFICATE",
 					},
-					Required: true,
 				},
 				&cli.StringFlag{
 					Name:  "tls-key",
@@ -53,7 +60,6 @@ func Run(args []string) int {
 					EnvVars: []string{
 						sitred.EnvPrefix + "_TLS_KEY",
 					},
-					Required: true,
 				},
 				&cli.StringFlag{
 					Name:  "tls-version",
@@ -63,9 +69,25 @@ func Run(args []string) int {
 						sitred.EnvPrefix + "_TLS_VERSION",
 					},
 				},
+				&cli.DurationFlag{
+					Name:  "tls-reload-interval",
+					Usage: "how often to check for a renewed TLS certificate; 0 disables it",
+					Value: config.DefaultTLSReloadInterval,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_TLS_RELOAD_INTERVAL",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "tls-disable",
+					Usage: "serve plain HTTP, for use behind a proxy that terminates TLS",
+					Value: false,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_TLS_DISABLE",
+					},
+				},
 				&cli.StringFlag{
 					Name:  "server-address",
-					Usage: "address to bind to",
+					Usage: "address to bind to; use unix:PATH for a Unix domain socket",
 					Value: config.DefaultAddress,
 					EnvVars: []string{
 						sitred.EnvPrefix + "_SERVER_ADDRESS",
@@ -79,6 +101,22 @@ func Run(args []string) int {
 						sitred.EnvPrefix + "_CACHE_TTL",
 					},
 				},
+				&cli.DurationFlag{
+					Name:  "server-refresh-timeout",
+					Usage: "maximum time spent loading a sitemap, including the children of a sitemap index",
+					Value: config.DefaultRefreshTimeout,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_REFRESH_TIMEOUT",
+					},
+				},
+				&cli.Float64Flag{
+					Name:  "server-fetch-rate",
+					Usage: "maximum number of sitemaps downloaded per second",
+					Value: config.DefaultFetchRate,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_FETCH_RATE",
+					},
+				},
 				&cli.BoolFlag{
 					Name:  "server-access-log",
 					Usage: "whether to enable access logs",
@@ -109,7 +147,221 @@ func Run(args []string) int {
 					EnvVars: []string{
 						sitred.EnvPrefix + "_SITEMAP_URL",
 					},
-					Required: true,
+				},
+				&cli.StringSliceFlag{
+					Name:  "sitemap-route",
+					Usage: "map a host or path prefix to its own sitemap, in the [HOST][/PREFIX]=URL format",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SITEMAP_ROUTES",
+					},
+				},
+				&cli.StringFlag{
+					Name:  "sitemap-format",
+					Usage: "format of the sitemap; auto, xml, text, rss or atom",
+					Value: config.DefaultSitemapFormat,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SITEMAP_FORMAT",
+					},
+				},
+				&cli.IntFlag{
+					Name:  "sitemap-max-depth",
+					Usage: "maximum number of nested sitemap indexes to follow",
+					Value: config.DefaultSitemapMaxDepth,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SITEMAP_MAX_DEPTH",
+					},
+				},
+				&cli.IntFlag{
+					Name:  "sitemap-sample-size",
+					Usage: "number of URLs randomly sampled from the sitemap on every load, for huge sitemaps; 0 keeps every URL",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SITEMAP_SAMPLE_SIZE",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "sitemap-strict",
+					Usage: "reject xml sitemaps that don't follow the sitemaps protocol",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SITEMAP_STRICT",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  "normalize-strip-param",
+					Usage: "remove query parameters matching one of these names, such as utm_*, from every URL",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_NORMALIZE_STRIP_PARAMS",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "normalize-https",
+					Usage: "rewrite http URLs to https",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_NORMALIZE_HTTPS",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "normalize-trailing-slash",
+					Usage: "treat URLs that only differ by a trailing slash as duplicates",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_NORMALIZE_TRAILING_SLASH",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  "filter-include",
+					Usage: "only redirect to URLs whose path matches one of these glob or re:REGEX patterns",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_FILTER_INCLUDE",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  "filter-exclude",
+					Usage: "never redirect to URLs whose path matches one of these glob or re:REGEX patterns",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_FILTER_EXCLUDE",
+					},
+				},
+				&cli.StringSliceFlag{
+					Name:  "filter-host",
+					Usage: "only redirect to URLs on one of these hosts",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_FILTER_HOSTS",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "filter-strip-query",
+					Usage: "remove the query string from every URL",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_FILTER_STRIP_QUERY",
+					},
+				},
+				&cli.StringFlag{
+					Name:  "selection-mode",
+					Usage: "how to choose a random URL; uniform, priority, recency, shuffle, round-robin or seeded",
+					Value: config.DefaultSelectionMode,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SELECTION_MODE",
+					},
+				},
+				&cli.DurationFlag{
+					Name:  "selection-recency-window",
+					Usage: "window within which recently modified URLs are favored in the recency mode",
+					Value: config.DefaultSelectionRecencyWindow,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SELECTION_RECENCY_WINDOW",
+					},
+				},
+				&cli.StringFlag{
+					Name:  "selection-seed",
+					Usage: "seed used by the seeded selection mode",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_SELECTION_SEED",
+					},
+				},
+				&cli.IntFlag{
+					Name:  "redirect-status",
+					Usage: "status code of redirects; 302, 303 or 307",
+					Value: config.DefaultRedirectStatus,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_REDIRECT_STATUS",
+					},
+				},
+				&cli.StringFlag{
+					Name:  "redirect-cache-control",
+					Usage: "cache-control header of redirects",
+					Value: config.DefaultRedirectCacheControl,
+					EnvVars: []string{
+						sitred.EnvPrefix + "_REDIRECT_CACHE_CONTROL",
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "redirect-page",
+					Usage: "include an html page with a link to the target in redirects",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_REDIRECT_PAGE",
+					},
+				},
+				&cli.IntFlag{
+					Name:  "visitor-history",
+					Usage: "number of recently served URLs a visitor isn't redirected to again; 0 disables it",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_VISITOR_HISTORY",
+					},
+				},
+				&cli.StringFlag{
+					Name:  "visitor-secret",
+					Usage: "secret used to sign visitor history cookies",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_VISITOR_SECRET",
+					},
+				},
+				&cli.StringFlag{
+					Name:  "metrics-address",
+					Usage: "serve metrics on a separate address instead of the server address; use unix:PATH for a Unix domain socket",
+					EnvVars: []string{
+						sitred.EnvPrefix + "_METRICS_ADDRESS",
+					},
+				},
+			},
+		},
+		{
+			Name:  "sitemap",
+			Usage: "inspect sitemaps",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "check",
+					Usage:  "check a sitemap for problems and exit with an error if any is found",
+					Action: CheckAction,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "sitemap-url",
+							Usage: "url of the sitemap to check",
+							EnvVars: []string{
+								sitred.EnvPrefix + "_SITEMAP_URL",
+							},
+						},
+						&cli.StringFlag{
+							Name:  "sitemap-format",
+							Usage: "format of the sitemap; auto, xml, text, rss or atom",
+							Value: config.DefaultSitemapFormat,
+							EnvVars: []string{
+								sitred.EnvPrefix + "_SITEMAP_FORMAT",
+							},
+						},
+						&cli.IntFlag{
+							Name:  "sitemap-max-depth",
+							Usage: "maximum number of nested sitemap indexes to follow",
+							Value: config.DefaultSitemapMaxDepth,
+							EnvVars: []string{
+								sitred.EnvPrefix + "_SITEMAP_MAX_DEPTH",
+							},
+						},
+						&cli.StringSliceFlag{
+							Name:  "normalize-strip-param",
+							Usage: "remove query parameters matching one of these names, such as utm_*, from every URL",
+							EnvVars: []string{
+								sitred.EnvPrefix + "_NORMALIZE_STRIP_PARAMS",
+							},
+						},
+						&cli.BoolFlag{
+							Name:  "normalize-https",
+							Usage: "rewrite http URLs to https",
+							EnvVars: []string{
+								sitred.EnvPrefix + "_NORMALIZE_HTTPS",
+							},
+						},
+						&cli.BoolFlag{
+							Name:  "normalize-trailing-slash",
+							Usage: "treat URLs that only differ by a trailing slash as duplicates",
+							EnvVars: []string{
+								sitred.EnvPrefix + "_NORMALIZE_TRAILING_SLASH",
+							},
+						},
+						&cli.StringFlag{
+							Name:  "output",
+							Usage: "output format; text or json",
+							Value: OutputText,
+						},
+					},
 				},
 			},
 		},
@@ -118,9 +370,19 @@ func Run(args []string) int {
 			Usage:  "stop the server",
 			Action: StopAction,
 		},
+		{
+			Name:   "reload",
+			Usage:  "reload the server's configuration and TLS certificate",
+			Action: ReloadAction,
+		},
 	}
 
 	if err := app.Run(args); err != nil {
+		// The report already explains what's wrong with the sitemap.
+		if errors.Is(err, ErrCheckFailed) {
+			return 1
+		}
+
 		logger.LogAttrs(
 			context.Background(),
 			slog.LevelError,
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"git.sr.ht/~jamesponddotco/sitred"
+	"git.sr.ht/~jamesponddotco/sitred/internal/config"
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/inspect"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// ErrCheckFailed is returned when the sitemap check finds issues.
+	ErrCheckFailed xerrors.Error = "sitemap check found issues"
+
+	// ErrMissingCheckURL is returned when no sitemap URL is given to the
+	// sitemap check command.
+	ErrMissingCheckURL xerrors.Error = "sitemap URL is missing"
+
+	// ErrInvalidOutput is returned when the output format isn't supported.
+	ErrInvalidOutput xerrors.Error = "output format is invalid; must be text or json"
+)
+
+// Output formats of the sitemap check command.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// CheckAction is the action for the sitemap check command.
+func CheckAction(ctx *cli.Context) error {
+	uri := ctx.String("sitemap-url")
+	if uri == "" {
+		return ErrMissingCheckURL
+	}
+
+	output := ctx.String("output")
+	if output != OutputText && output != OutputJSON {
+		return ErrInvalidOutput
+	}
+
+	// Publishers run the check to find out what's wrong with their sitemaps,
+	// so report everything that doesn't follow the protocol.
+	parser, err := sitemap.ParserFor(sitemap.Format(ctx.String("sitemap-format")), true)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	// Find duplicates the way the server would.
+	rules := &config.Normalize{
+		StripParams:   ctx.StringSlice("normalize-strip-param"),
+		HTTPS:         ctx.Bool("normalize-https"),
+		TrailingSlash: ctx.Bool("normalize-trailing-slash"),
+	}
+
+	normalizer, err := rules.Compile()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	var (
+		fetchClient = fetch.New(sitred.Name, sitred.URL, fetch.DefaultRateLimit)
+		inspector   = inspect.New(fetchClient, parser, normalizer, ctx.Int("sitemap-max-depth"))
+		report      = inspector.Inspect(ctx.Context, uri)
+	)
+
+	if output == OutputJSON {
+		err = writeReportJSON(ctx.App.Writer, report)
+	} else {
+		err = writeReportText(ctx.App.Writer, report)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if !report.OK() {
+		return ErrCheckFailed
+	}
+
+	return nil
+}
+
+// writeReportJSON writes a sitemap report as indented JSON.
+func writeReportJSON(w io.Writer, report *inspect.Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// writeReportText writes a sitemap report in a human-readable format.
+func writeReportText(w io.Writer, report *inspect.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Sitemap:\t%s\n", report.URL)
+	fmt.Fprintf(tw, "Documents:\t%d\n", len(report.Documents))
+	fmt.Fprintf(tw, "URLs:\t%d (%d unique)\n", report.URLs, report.Unique)
+	fmt.Fprintf(tw, "Issues:\t%d\n", len(report.Issues))
+
+	if len(report.Documents) > 0 {
+		fmt.Fprintln(tw)
+
+		for _, doc := range report.Documents {
+			if doc.Index {
+				fmt.Fprintf(tw, "%s\tindex\t%d sitemaps\t%d bytes\n", doc.URL, doc.Sitemaps, doc.Size)
+
+				continue
+			}
+
+			fmt.Fprintf(tw, "%s\tsitemap\t%d URLs\t%d bytes\n", doc.URL, doc.URLs, doc.Size)
+		}
+	}
+
+	if len(report.Issues) > 0 {
+		fmt.Fprintln(tw)
+
+		for _, issue := range report.Issues {
+			subject := issue.URL
+			if subject == "" {
+				subject = issue.Sitemap
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", issue.Kind, subject, issue.Message)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+package app
+
+import (
+	"fmt"
+	"syscall"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// ReloadAction is the action for the reload command.
+func ReloadAction(ctx *cli.Context) error {
+	pidFile, err := config.ParsePID(ctx)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return signalServer(pidFile, syscall.SIGHUP)
+}
@@ -21,7 +21,11 @@ func StartAction(ctx *cli.Context) error {
 		return fmt.Errorf("%w", err)
 	}
 
-	srv, err := server.New(cfg, logger)
+	loader := func() (*config.Config, error) {
+		return config.Parse(ctx)
+	}
+
+	srv, err := server.New(cfg, loader, logger)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
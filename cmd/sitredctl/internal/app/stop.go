@@ -12,31 +12,41 @@ import (
 
 // StopAction is the action for the stop command.
 func StopAction(ctx *cli.Context) error {
-	cfg, err := config.Parse(ctx)
+	pidFile, err := config.ParsePID(ctx)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	pidFileData, err := os.ReadFile(cfg.Server.PID)
-	if err != nil {
+	if err = signalServer(pidFile, os.Interrupt); err != nil {
+		return err
+	}
+
+	if err = os.Remove(pidFile); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	pid, err := strconv.Atoi(strings.TrimSpace(string(pidFileData)))
+	return nil
+}
+
+// signalServer sends a signal to the server process whose PID is stored in
+// pidFile.
+func signalServer(pidFile string, sig os.Signal) error {
+	pidFileData, err := os.ReadFile(pidFile)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	process, err := os.FindProcess(pid)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidFileData)))
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	if err = process.Signal(os.Interrupt); err != nil {
+	process, err := os.FindProcess(pid)
+	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	if err = os.Remove(cfg.Server.PID); err != nil {
+	if err = process.Signal(sig); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
@@ -5,6 +5,7 @@ go 1.21
 require (
 	git.sr.ht/~jamesponddotco/httpx-go v0.0.0-20230516151239-08a439b40481
 	git.sr.ht/~jamesponddotco/xstd-go v0.4.0
+	github.com/BurntSushi/toml v1.3.2
 	github.com/urfave/cli/v2 v2.25.7
 	golang.org/x/time v0.3.0
 )
@@ -0,0 +1,502 @@
+// Package cache provides an in-memory cache for parsed sitemaps.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/filter"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/normalize"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// DefaultRefreshTimeout is the default maximum amount of time a refresh of the
+// sitemap is allowed to take.
+const DefaultRefreshTimeout = 2 * time.Minute
+
+// DefaultRetryInterval is how long to wait before retrying a failed
+// background refresh of the sitemap.
+const DefaultRetryInterval = time.Minute
+
+// Sitemap keeps the list of URLs parsed from a sitemap in memory and refreshes
+// it once its time-to-live expires.
+//
+// Stale entries are refreshed in the background while the previous list keeps
+// being served, and a failed refresh never discards the last good list.
+type Sitemap struct {
+	// resolver is used to download the sitemap and any child sitemaps.
+	resolver *sitemap.Resolver
+
+	// filter decides which of the sitemap's URLs are kept. A nil filter keeps
+	// every URL.
+	filter *filter.Filter
+
+	// normalizer canonicalizes the sitemap's URLs and removes duplicates. A
+	// nil normalizer applies the default rules.
+	normalizer *normalize.Normalizer
+
+	// metrics records cache hits, misses and sitemap fetches. A nil metrics
+	// records nothing.
+	metrics *metrics.Metrics
+
+	// logger is the logger used to report background refresh failures and
+	// filtered URLs.
+	logger *slog.Logger
+
+	// url is the URL of the sitemap.
+	url string
+
+	// ttl is how long a parsed sitemap is considered fresh.
+	ttl time.Duration
+
+	// refreshTimeout is the maximum amount of time a refresh is allowed to
+	// take.
+	refreshTimeout time.Duration
+
+	// sampleSize is the number of URLs randomly sampled from the sitemap on
+	// every refresh. Zero keeps every URL.
+	sampleSize int
+
+	// urls is the list of URLs from the last successful refresh.
+	urls []sitemap.URL
+
+	// fetchedAt is the time of the last successful refresh.
+	fetchedAt time.Time
+
+	// failedAt is the time of the last failed refresh.
+	failedAt time.Time
+
+	// lastErr is the error of the last failed refresh.
+	lastErr error
+
+	// generation is incremented every time urls is replaced.
+	generation uint64
+
+	// mu protects urls, fetchedAt, failedAt, lastErr and generation.
+	mu sync.RWMutex
+
+	// loadMu serializes refreshes so concurrent requests don't download the
+	// same sitemap more than once.
+	loadMu sync.Mutex
+
+	// refreshing is closed once the background refresh in progress, if any,
+	// completes.
+	refreshing chan struct{}
+
+	// refreshingMu protects refreshing.
+	refreshingMu sync.Mutex
+}
+
+// Stats describes the state of a Sitemap cache.
+type Stats struct {
+	// FetchedAt is the time of the last successful refresh, or the zero time
+	// if the sitemap was never loaded.
+	FetchedAt time.Time
+
+	// FailedAt is the time of the last failed refresh, or the zero time if no
+	// refresh ever failed.
+	FailedAt time.Time
+
+	// LastError is the error of the last failed refresh, if any.
+	LastError error
+
+	// URLs is the number of cached URLs.
+	URLs int
+}
+
+// Ready reports whether the sitemap was loaded successfully at least once.
+func (s Stats) Ready() bool {
+	return !s.FetchedAt.IsZero()
+}
+
+// New returns a new Sitemap cache for the given sitemap URL. Every time the
+// sitemap is loaded, its URLs are normalized with normalizer, which may be
+// nil, filtered with urlFilter if it isn't nil, and deduplicated; a sitemap
+// listing a relative or non-HTTP location fails to load. If collector isn't
+// nil, cache hits, misses and fetches are recorded in it.
+//
+// Refreshes, including the first load, are given refreshTimeout to complete,
+// or DefaultRefreshTimeout if it isn't positive. Sitemap indexes with many
+// children may need more, as children are downloaded one at a time within the
+// rate limit of the resolver's client.
+//
+// If sampleSize is greater than zero, the sitemap is streamed instead of
+// loaded in full, and only a uniformly random sample of that many URLs is
+// kept, so memory use doesn't grow with the size of the sitemap. A new sample
+// is taken on every refresh, and only duplicates within the sample are
+// removed.
+func New(
+	resolver *sitemap.Resolver,
+	normalizer *normalize.Normalizer,
+	urlFilter *filter.Filter,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+	sitemapURL string,
+	ttl time.Duration,
+	refreshTimeout time.Duration,
+	sampleSize int,
+) *Sitemap {
+	if refreshTimeout <= 0 {
+		refreshTimeout = DefaultRefreshTimeout
+	}
+
+	return &Sitemap{
+		resolver:       resolver,
+		filter:         urlFilter,
+		normalizer:     normalizer,
+		metrics:        collector,
+		logger:         logger,
+		url:            sitemapURL,
+		ttl:            ttl,
+		refreshTimeout: refreshTimeout,
+		sampleSize:     sampleSize,
+	}
+}
+
+// URL returns the URL of the cached sitemap.
+func (s *Sitemap) URL() string {
+	return s.url
+}
+
+// URLs returns the cached list of URLs.
+//
+// If the sitemap has never been loaded, URLs blocks until the first refresh
+// completes or ctx is done, unless the last attempt failed less than
+// DefaultRetryInterval ago, in which case its error is returned right away.
+// The first refresh runs in the background, so it isn't canceled along with
+// ctx and later calls benefit from it. If the cached list is stale, a refresh
+// is started in the background and the stale list is returned.
+func (s *Sitemap) URLs(ctx context.Context) ([]sitemap.URL, error) {
+	urls, _, err := s.Snapshot(ctx)
+
+	return urls, err
+}
+
+// Snapshot is like URLs, but also returns the generation of the list, which
+// changes every time the cached list is replaced, so callers keeping state
+// about the list can tell when it changed without comparing it.
+func (s *Sitemap) Snapshot(ctx context.Context) ([]sitemap.URL, uint64, error) {
+	s.mu.RLock()
+	urls, generation, fetchedAt, failedAt := s.urls, s.generation, s.fetchedAt, s.failedAt
+	s.mu.RUnlock()
+
+	if fetchedAt.IsZero() {
+		s.metrics.CacheMiss(s.url)
+
+		if err := s.recentFailure(); err != nil {
+			return nil, 0, err
+		}
+
+		return s.load(ctx)
+	}
+
+	s.metrics.CacheHit(s.url)
+
+	if time.Since(fetchedAt) >= s.ttl && time.Since(failedAt) >= DefaultRetryInterval {
+		s.refreshInBackground()
+	}
+
+	return urls, generation, nil
+}
+
+// Refresh downloads and parses the sitemap, replacing the cached list of URLs
+// on success. The refresh is given at most the refresh timeout of the cache,
+// or less if ctx has an earlier deadline.
+func (s *Sitemap) Refresh(ctx context.Context) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	return s.refresh(ctx)
+}
+
+// load waits for the initial refresh of the sitemap, which runs in the
+// background, and returns its result. If ctx is done first, its error is
+// returned, but the refresh keeps running.
+func (s *Sitemap) load(ctx context.Context) ([]sitemap.URL, uint64, error) {
+	select {
+	case <-s.refreshInBackground():
+	case <-ctx.Done():
+		return nil, 0, fmt.Errorf("%w", ctx.Err())
+	}
+
+	urls, generation, fetchedAt := s.snapshot()
+	if fetchedAt.IsZero() {
+		return nil, 0, s.Stats().LastError
+	}
+
+	return urls, generation, nil
+}
+
+// refreshInBackground starts a refresh in a new goroutine unless one is
+// already running, and returns a channel closed once the running refresh
+// completes.
+func (s *Sitemap) refreshInBackground() <-chan struct{} {
+	s.refreshingMu.Lock()
+	defer s.refreshingMu.Unlock()
+
+	if s.refreshing != nil {
+		return s.refreshing
+	}
+
+	var (
+		done   = make(chan struct{})
+		before = s.Stats()
+	)
+
+	s.refreshing = done
+
+	go func() {
+		defer func() {
+			s.refreshingMu.Lock()
+			s.refreshing = nil
+			s.refreshingMu.Unlock()
+
+			close(done)
+		}()
+
+		s.loadMu.Lock()
+		defer s.loadMu.Unlock()
+
+		// Another refresh, such as one started with Refresh, may have completed
+		// while waiting for the lock, in which case there's nothing to do.
+		if after := s.Stats(); !after.FetchedAt.Equal(before.FetchedAt) || !after.FailedAt.Equal(before.FailedAt) {
+			return
+		}
+
+		ctx := context.Background()
+
+		if err := s.refresh(ctx); err != nil && before.Ready() {
+			s.logger.LogAttrs(
+				ctx,
+				slog.LevelError,
+				"failed to refresh sitemap; serving stale copy",
+				slog.String("url", s.url),
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	return done
+}
+
+// refresh downloads and parses the sitemap within the refresh timeout. The
+// caller must hold loadMu.
+func (s *Sitemap) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.refreshTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	urls, err := s.fetch(ctx)
+
+	s.metrics.Fetch(s.url, time.Since(start), err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A canceled context means the caller gave up, such as a visitor closing
+	// the connection during the first load, not that the sitemap failed.
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.failedAt = time.Now()
+		s.lastErr = err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.urls = urls
+	s.generation++
+	s.fetchedAt = time.Now()
+
+	s.metrics.URLs(s.url, len(urls))
+
+	return nil
+}
+
+// fetch downloads and parses the sitemap, following sitemap indexes, and
+// normalizes, filters and deduplicates the result.
+func (s *Sitemap) fetch(ctx context.Context) ([]sitemap.URL, error) {
+	if s.sampleSize > 0 {
+		return s.sample(ctx)
+	}
+
+	visit, progress := s.visit(ctx)
+
+	urls, err := s.resolver.Resolve(ctx, s.url, visit)
+	if err != nil {
+		s.logTimeout(ctx, err, progress)
+
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	normalized, err := s.normalizer.Apply(urls)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	kept, counts := s.filter.Apply(normalized)
+
+	s.logFiltered(ctx, counts)
+
+	return s.dedupe(ctx, kept), nil
+}
+
+// sample streams the sitemap, following sitemap indexes, and returns a random
+// sample of the normalized URLs that pass the filter, without duplicates.
+func (s *Sitemap) sample(ctx context.Context) ([]sitemap.URL, error) {
+	var (
+		reservoir    = sitemap.NewReservoir(s.sampleSize)
+		walk, counts = s.filter.Walk(reservoir.Add)
+	)
+
+	visit, progress := s.visit(ctx)
+
+	if err := s.resolver.Walk(ctx, s.url, s.normalizer.Walk(walk), visit); err != nil {
+		s.logTimeout(ctx, err, progress)
+
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	s.logFiltered(ctx, counts())
+
+	s.logger.LogAttrs(
+		ctx,
+		slog.LevelDebug,
+		"sampled sitemap URLs",
+		slog.String("url", s.url),
+		slog.Int("seen", reservoir.Seen()),
+		slog.Int("kept", len(reservoir.URLs())),
+	)
+
+	return s.dedupe(ctx, reservoir.URLs()), nil
+}
+
+// progress counts the child sitemaps found and loaded during a refresh.
+type progress struct {
+	// children is the number of child sitemaps listed by the sitemap
+	// indexes loaded so far.
+	children int
+
+	// loaded is the number of child sitemaps loaded so far.
+	loaded int
+}
+
+// visit returns a sitemap.VisitFunc that logs the child sitemaps skipped
+// because they failed to load, along with the progress it records.
+func (s *Sitemap) visit(ctx context.Context) (sitemap.VisitFunc, *progress) {
+	p := &progress{}
+
+	return func(v *sitemap.Visit) error {
+		if v.Document != nil && v.Document.IsIndex() {
+			p.children += len(v.Document.Sitemaps)
+		}
+
+		if v.Err == nil && v.Parent != "" {
+			p.loaded++
+		}
+
+		// Children failing because the refresh timed out aren't skipped, as
+		// the whole refresh fails.
+		if v.Err != nil && v.Parent != "" && ctx.Err() == nil {
+			s.logger.LogAttrs(
+				ctx,
+				slog.LevelWarn,
+				"skipped child sitemap",
+				slog.String("url", s.url),
+				slog.String("child", v.URL),
+				slog.String("error", v.Err.Error()),
+			)
+		}
+
+		return v.Err
+	}, p
+}
+
+// logTimeout logs a refresh that failed because it ran out of time, along with
+// how far it got through the sitemap index, if any.
+func (s *Sitemap) logTimeout(ctx context.Context, err error, p *progress) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	s.logger.LogAttrs(
+		ctx,
+		slog.LevelError,
+		"sitemap refresh timed out; increase the refresh timeout or fetch rate for large sitemap indexes",
+		slog.String("url", s.url),
+		slog.Duration("timeout", s.refreshTimeout),
+		slog.Int("children", p.children),
+		slog.Int("loaded", p.loaded),
+	)
+}
+
+// dedupe removes duplicate URLs and logs how many were removed.
+func (s *Sitemap) dedupe(ctx context.Context, urls []sitemap.URL) []sitemap.URL {
+	unique, duplicates := s.normalizer.Dedupe(urls)
+	if duplicates > 0 {
+		s.logger.LogAttrs(
+			ctx,
+			slog.LevelInfo,
+			"removed duplicate sitemap URLs",
+			slog.String("url", s.url),
+			slog.Int("count", duplicates),
+		)
+	}
+
+	return unique
+}
+
+// logFiltered logs the number of URLs each filter rule filtered out.
+func (s *Sitemap) logFiltered(ctx context.Context, counts []filter.Count) {
+	for _, count := range counts {
+		s.logger.LogAttrs(
+			ctx,
+			slog.LevelInfo,
+			"filtered out sitemap URLs",
+			slog.String("url", s.url),
+			slog.String("rule", count.Rule),
+			slog.Int("count", count.Filtered),
+		)
+	}
+}
+
+// Stats returns the current state of the cache.
+func (s *Sitemap) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Stats{
+		FetchedAt: s.fetchedAt,
+		FailedAt:  s.failedAt,
+		LastError: s.lastErr,
+		URLs:      len(s.urls),
+	}
+}
+
+// recentFailure returns the error of the last refresh if it failed less than
+// DefaultRetryInterval ago, or nil otherwise.
+func (s *Sitemap) recentFailure() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.failedAt.IsZero() || time.Since(s.failedAt) >= DefaultRetryInterval {
+		return nil
+	}
+
+	return s.lastErr
+}
+
+// snapshot returns the cached list of URLs, its generation and the time it was
+// fetched.
+func (s *Sitemap) snapshot() (urls []sitemap.URL, generation uint64, fetchedAt time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.urls, s.generation, s.fetchedAt
+}
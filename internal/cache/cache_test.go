@@ -0,0 +1,453 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/normalize"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// testRateLimit is high enough for tests downloading several sitemaps not to
+// wait on the rate limit of the client.
+const testRateLimit = 1000
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>http://example.com/page1</loc>
+  </url>
+  <url>
+    <loc>http://example.com/page2</loc>
+  </url>
+</urlset>`
+
+func TestSitemap_URLs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		requests atomic.Int32
+		failing  atomic.Bool
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		if failing.Load() {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(testSitemap))
+	}))
+	defer srv.Close()
+
+	var (
+		ctx    = context.Background()
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client = fetch.New("TestService", "test@example.com", testRateLimit)
+		m      = metrics.New()
+		c      = cache.New(sitemap.NewResolver(client, nil, 0), nil, nil, m, logger, srv.URL, time.Hour, 0, 0)
+	)
+
+	for i := 0; i < 3; i++ {
+		urls, err := c.URLs(ctx)
+		if err != nil {
+			t.Fatalf("URLs() error = %v", err)
+		}
+
+		if len(urls) != 2 {
+			t.Fatalf("URLs() got %d URLs, want 2", len(urls))
+		}
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("sitemap fetched %d times, want 1", got)
+	}
+
+	failing.Store(true)
+
+	if err := c.Refresh(ctx); err == nil {
+		t.Fatal("Refresh() expected error, got nil")
+	}
+
+	urls, err := c.URLs(ctx)
+	if err != nil {
+		t.Fatalf("URLs() after failed refresh error = %v", err)
+	}
+
+	if len(urls) != 2 {
+		t.Errorf("URLs() after failed refresh got %d URLs, want 2", len(urls))
+	}
+
+	stats := c.Stats()
+
+	if !stats.Ready() || stats.URLs != 2 {
+		t.Errorf("Stats() = %+v, want ready with 2 URLs", stats)
+	}
+
+	if stats.LastError == nil || stats.FailedAt.IsZero() {
+		t.Errorf("Stats() = %+v, want the failed refresh to be recorded", stats)
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler(logger).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+	for _, want := range []string{
+		`sitred_cache_misses_total{sitemap="` + srv.URL + `"} 1`,
+		`sitred_cache_hits_total{sitemap="` + srv.URL + `"} 3`,
+		`sitred_sitemap_urls{sitemap="` + srv.URL + `"} 2`,
+		`sitred_sitemap_fetch_duration_seconds_count{sitemap="` + srv.URL + `",outcome="failure"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestSitemap_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	var failing atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(testSitemap))
+	}))
+	defer srv.Close()
+
+	var (
+		ctx    = context.Background()
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client = fetch.New("TestService", "test@example.com", testRateLimit)
+		c      = cache.New(sitemap.NewResolver(client, nil, 0), nil, nil, nil, logger, srv.URL, time.Hour, 0, 0)
+	)
+
+	_, first, err := c.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	if _, again, _ := c.Snapshot(ctx); again != first {
+		t.Errorf("Snapshot() generation = %d, want %d while the list is unchanged", again, first)
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	_, refreshed, _ := c.Snapshot(ctx)
+	if refreshed == first {
+		t.Errorf("Snapshot() generation = %d after a refresh, want a new one", refreshed)
+	}
+
+	failing.Store(true)
+
+	if err := c.Refresh(ctx); err == nil {
+		t.Fatal("Refresh() expected error, got nil")
+	}
+
+	if _, failed, _ := c.Snapshot(ctx); failed != refreshed {
+		t.Errorf("Snapshot() generation = %d after a failed refresh, want %d", failed, refreshed)
+	}
+}
+
+func TestSitemap_URLsError(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client = fetch.New("TestService", "test@example.com", testRateLimit)
+		c      = cache.New(sitemap.NewResolver(client, nil, 0), nil, nil, nil, logger, srv.URL, time.Hour, 0, 0)
+	)
+
+	// The error of the failed first load is returned right away until the
+	// retry interval passes, without downloading the sitemap again.
+	for i := 0; i < 3; i++ {
+		if _, err := c.URLs(context.Background()); !errors.Is(err, fetch.ErrFetchData) {
+			t.Errorf("URLs() error = %v, want %v", err, fetch.ErrFetchData)
+		}
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("sitemap fetched %d times, want 1", got)
+	}
+
+	if c.Stats().Ready() {
+		t.Error("Stats().Ready() = true, want false before the first successful load")
+	}
+}
+
+func TestSitemap_URLsSample(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(testSitemap))
+	}))
+	defer srv.Close()
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client = fetch.New("TestService", "test@example.com", testRateLimit)
+		c      = cache.New(sitemap.NewResolver(client, nil, 0), nil, nil, nil, logger, srv.URL, time.Hour, 0, 1)
+	)
+
+	urls, err := c.URLs(context.Background())
+	if err != nil {
+		t.Fatalf("URLs() error = %v", err)
+	}
+
+	if len(urls) != 1 {
+		t.Fatalf("URLs() got %d URLs, want a sample of 1", len(urls))
+	}
+
+	if loc := urls[0].Loc; loc != "http://example.com/page1" && loc != "http://example.com/page2" {
+		t.Errorf("URLs() got %q, want a URL from the sitemap", loc)
+	}
+}
+
+func TestSitemap_URLsNormalize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		content    string
+		sampleSize int
+		want       []string
+		wantErr    error
+	}{
+		{
+			name: "duplicates",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://Example.com:80/page1#top</loc></url>
+  <url><loc>http://example.com/page1?utm_source=feed</loc></url>
+  <url><loc>http://example.com/page2</loc></url>
+</urlset>`,
+			want: []string{"http://example.com/page1", "http://example.com/page2"},
+		},
+		{
+			name: "duplicates in sample",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/page1</loc></url>
+  <url><loc>http://EXAMPLE.com/page1</loc></url>
+</urlset>`,
+			sampleSize: 10,
+			want:       []string{"http://example.com/page1"},
+		},
+		{
+			name: "relative location",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/page1</loc></url>
+  <url><loc>/page2</loc></url>
+</urlset>`,
+			wantErr: normalize.ErrInvalidLocation,
+		},
+		{
+			name: "non-http location in sample",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>mailto:hello@example.com</loc></url>
+</urlset>`,
+			sampleSize: 10,
+			wantErr:    normalize.ErrInvalidLocation,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(tt.content))
+			}))
+			defer srv.Close()
+
+			normalizer, err := normalize.New([]string{"utm_*"}, false, false)
+			if err != nil {
+				t.Fatalf("normalize.New() error = %v", err)
+			}
+
+			var (
+				logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+				client = fetch.New("TestService", "test@example.com", testRateLimit)
+				c      = cache.New(sitemap.NewResolver(client, nil, 0), normalizer, nil, nil, logger, srv.URL, time.Hour, 0, tt.sampleSize)
+			)
+
+			urls, err := c.URLs(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("URLs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if locs := sitemap.Locs(urls); tt.wantErr == nil && !reflect.DeepEqual(locs, tt.want) {
+				t.Errorf("URLs() got %v, want %v", locs, tt.want)
+			}
+		})
+	}
+}
+
+func TestSitemap_LargeIndex(t *testing.T) {
+	t.Parallel()
+
+	const children = 300
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.xml" {
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com%s</loc></url>
+</urlset>`, r.URL.Path)
+
+			return
+		}
+
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+
+		for i := 0; i < children; i++ {
+			fmt.Fprintf(w, "<sitemap><loc>http://%s/child%d.xml</loc></sitemap>\n", r.Host, i)
+		}
+
+		fmt.Fprint(w, `</sitemapindex>`)
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		rate    float64
+		timeout time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "within the refresh timeout",
+			rate:    1000,
+			timeout: 30 * time.Second,
+		},
+		{
+			name:    "refresh timeout too short for the fetch rate",
+			rate:    fetch.DefaultRateLimit,
+			timeout: 500 * time.Millisecond,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				logs     bytes.Buffer
+				logger   = slog.New(slog.NewTextHandler(&logs, nil))
+				client   = fetch.New("TestService", "test@example.com", tt.rate)
+				resolver = sitemap.NewResolver(client, nil, 0)
+				c        = cache.New(resolver, nil, nil, nil, logger, srv.URL+"/index.xml", time.Hour, tt.timeout, 0)
+			)
+
+			err := c.Refresh(context.Background())
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Refresh() error = %v", err)
+				}
+
+				if got := c.Stats().URLs; got != children {
+					t.Errorf("Stats() URLs = %d, want %d", got, children)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Refresh() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			got := logs.String()
+
+			if !strings.Contains(got, "sitemap refresh timed out") || !strings.Contains(got, fmt.Sprintf("children=%d", children)) {
+				t.Errorf("logs = %q, want the timeout to be logged with the number of children", got)
+			}
+
+			if strings.Contains(got, "skipped child sitemap") {
+				t.Errorf("logs = %q, want children failing because of the timeout not to be reported as skipped", got)
+			}
+		})
+	}
+}
+
+func TestSitemap_URLsCanceled(t *testing.T) {
+	t.Parallel()
+
+	var (
+		requests atomic.Int32
+		release  = make(chan struct{})
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		<-release
+
+		_, _ = w.Write([]byte(testSitemap))
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client = fetch.New("TestService", "test@example.com", testRateLimit)
+		c      = cache.New(sitemap.NewResolver(client, nil, 0), nil, nil, nil, logger, srv.URL, time.Hour, 0, 0)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// A visitor giving up on the first load doesn't cancel it.
+	if _, err := c.URLs(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("URLs() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	urls, err := c.URLs(context.Background())
+	if err != nil {
+		t.Fatalf("URLs() error = %v", err)
+	}
+
+	if len(urls) != 2 {
+		t.Errorf("URLs() got %d URLs, want 2", len(urls))
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("sitemap fetched %d times, want 1", got)
+	}
+}
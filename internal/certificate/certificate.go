@@ -0,0 +1,169 @@
+// Package certificate provides a TLS certificate store that reloads renewed
+// certificates from disk without restarting the server.
+package certificate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+// ErrLoadCertificate is returned when the TLS certificate cannot be loaded.
+const ErrLoadCertificate xerrors.Error = "failed to load TLS certificate"
+
+// DefaultPollInterval is the default interval between checks for renewed
+// certificates.
+const DefaultPollInterval = time.Minute
+
+// Store holds a TLS certificate loaded from disk and serves it to TLS
+// handshakes.
+//
+// During handshakes, at most once per poll interval, the Store checks whether
+// the modification time of the certificate or key file changed and loads the
+// new pair if so. If the new pair can't be loaded, for example because the key
+// doesn't match the certificate, the error is logged and the last good pair
+// keeps being served.
+type Store struct {
+	// logger is the logger used to report reload failures.
+	logger *slog.Logger
+
+	// cert is the certificate served to clients.
+	cert atomic.Pointer[tls.Certificate]
+
+	// certFile is the path to the certificate file.
+	certFile string
+
+	// keyFile is the path to the key file.
+	keyFile string
+
+	// certModTime is the modification time of certFile when last checked.
+	certModTime time.Time
+
+	// keyModTime is the modification time of keyFile when last checked.
+	keyModTime time.Time
+
+	// checkedAt is the time of the last check, in Unix nanoseconds.
+	checkedAt atomic.Int64
+
+	// interval is the minimum time between checks. Zero disables checks.
+	interval time.Duration
+
+	// mu serializes checks and reloads, and protects certModTime and
+	// keyModTime.
+	mu sync.Mutex
+}
+
+// New loads the certificate and key at the given paths and returns a Store
+// serving them, which checks for renewed files every interval. An interval of
+// zero disables automatic reloading.
+func New(certFile, keyFile string, interval time.Duration, logger *slog.Logger) (*Store, error) {
+	s := &Store{
+		logger:   logger,
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload loads the certificate and key from disk again. If they can't be
+// loaded, the previous certificate is kept and an error is returned.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.certModTime, s.keyModTime = modTime(s.certFile), modTime(s.keyFile)
+	s.checkedAt.Store(time.Now().UnixNano())
+
+	return s.load()
+}
+
+// GetCertificate returns the current certificate, reloading it first if it
+// changed on disk. It's meant to be used as the GetCertificate field of a
+// tls.Config.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.interval > 0 && time.Since(time.Unix(0, s.checkedAt.Load())) >= s.interval {
+		ctx := context.Background()
+		if hello != nil {
+			ctx = hello.Context()
+		}
+
+		s.check(ctx)
+	}
+
+	return s.cert.Load(), nil
+}
+
+// check reloads the certificate if either file changed since the last check.
+func (s *Store) check(ctx context.Context) {
+	if !s.mu.TryLock() {
+		// Another handshake is already checking.
+		return
+	}
+	defer s.mu.Unlock()
+
+	s.checkedAt.Store(time.Now().UnixNano())
+
+	certModTime, keyModTime := modTime(s.certFile), modTime(s.keyFile)
+
+	if certModTime.Equal(s.certModTime) && keyModTime.Equal(s.keyModTime) {
+		return
+	}
+
+	s.certModTime, s.keyModTime = certModTime, keyModTime
+
+	if err := s.load(); err != nil {
+		s.logger.LogAttrs(
+			ctx,
+			slog.LevelError,
+			"failed to reload renewed TLS certificate; keeping previous certificate",
+			slog.String("certificate", s.certFile),
+			slog.String("key", s.keyFile),
+			slog.String("error", err.Error()),
+		)
+
+		return
+	}
+
+	s.logger.LogAttrs(
+		ctx,
+		slog.LevelInfo,
+		"reloaded renewed TLS certificate",
+		slog.String("certificate", s.certFile),
+	)
+}
+
+// load loads the certificate and key from disk. The caller must hold mu.
+func (s *Store) load() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLoadCertificate, err)
+	}
+
+	s.cert.Store(&cert)
+
+	return nil
+}
+
+// modTime returns the modification time of a file, or the zero time if it
+// cannot be determined.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
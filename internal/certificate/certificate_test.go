@@ -0,0 +1,150 @@
+package certificate_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/certificate"
+)
+
+// writePair writes a self-signed certificate and its key to dir and returns
+// their paths.
+func writePair(t *testing.T, dir, name string, modTime time.Time) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, name+"-cert.pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+
+	writePEM(t, certFile, "CERTIFICATE", der, modTime)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER, modTime)
+
+	return certFile, keyFile
+}
+
+// writePEM writes a PEM block to path and sets its modification time.
+func writePEM(t *testing.T, path, blockType string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", path, err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("could not set modification time of %s: %v", path, err)
+	}
+}
+
+// copyFile copies src to dst and sets the modification time of dst.
+func copyFile(t *testing.T, src, dst string, modTime time.Time) {
+	t.Helper()
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("could not read %s: %v", src, err)
+	}
+
+	if err = os.WriteFile(dst, data, 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", dst, err)
+	}
+
+	if err = os.Chtimes(dst, modTime, modTime); err != nil {
+		t.Fatalf("could not set modification time of %s: %v", dst, err)
+	}
+}
+
+// commonName returns the common name of the certificate served by store.
+func commonName(t *testing.T, store *certificate.Store) string {
+	t.Helper()
+
+	cert, err := store.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestStore_GetCertificate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir               = t.TempDir()
+		past              = time.Now().Add(-time.Hour)
+		certFile, keyFile = writePair(t, dir, "old", past)
+		newCert, newKey   = writePair(t, dir, "new", past)
+		logger            = slog.New(slog.NewTextHandler(io.Discard, nil))
+	)
+
+	store, err := certificate.New(certFile, keyFile, time.Nanosecond, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if got := commonName(t, store); got != "old" {
+		t.Fatalf("GetCertificate() served %q, want %q", got, "old")
+	}
+
+	// Renew only the certificate, so it doesn't match the key anymore.
+	copyFile(t, newCert, certFile, past.Add(time.Minute))
+
+	if got := commonName(t, store); got != "old" {
+		t.Errorf("GetCertificate() with mismatched pair served %q, want %q", got, "old")
+	}
+
+	// Renew the key as well.
+	copyFile(t, newKey, keyFile, past.Add(2*time.Minute))
+
+	if got := commonName(t, store); got != "new" {
+		t.Errorf("GetCertificate() after renewal served %q, want %q", got, "new")
+	}
+}
+
+func TestNew_Error(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, err := certificate.New("missing-cert.pem", "missing-key.pem", 0, logger)
+	if !errors.Is(err, certificate.ErrLoadCertificate) {
+		t.Errorf("New() error = %v, want %v", err, certificate.ErrLoadCertificate)
+	}
+}
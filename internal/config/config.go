@@ -3,11 +3,19 @@ package config
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"git.sr.ht/~jamesponddotco/sitred"
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/certificate"
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/filter"
+	"git.sr.ht/~jamesponddotco/sitred/internal/normalize"
+	"git.sr.ht/~jamesponddotco/sitred/internal/policy"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
 	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
 	"github.com/urfave/cli/v2"
 )
@@ -25,9 +33,16 @@ const (
 	// ErrInvalidTLSVersion is returned when the TLS version is invalid.
 	ErrInvalidTLSVersion xerrors.Error = "server's TLS version is invalid; must be 1.2 or 1.3"
 
+	// ErrInvalidTLSReloadInterval is returned when the TLS reload interval is
+	// invalid.
+	ErrInvalidTLSReloadInterval xerrors.Error = "server's TLS reload interval is invalid; cannot be negative"
+
 	// ErrMissingServerAddress is returned when the server address is missing.
 	ErrMissingServerAddress xerrors.Error = "server address is missing"
 
+	// ErrInvalidServerAddress is returned when the server address is invalid.
+	ErrInvalidServerAddress xerrors.Error = "server address is invalid; must be HOST:PORT or unix:PATH"
+
 	// ErrMissingServerPID is returned when the server PID is missing.
 	ErrMissingServerPID xerrors.Error = "server PID is missing"
 
@@ -43,8 +58,57 @@ const (
 	// ErrInvalidServerCacheTTL is returned when the server cache TTL is invalid.
 	ErrInvalidServerCacheTTL xerrors.Error = "server cache TTL is invalid; must be a positive duration"
 
+	// ErrInvalidServerRefreshTimeout is returned when the server refresh
+	// timeout is invalid.
+	ErrInvalidServerRefreshTimeout xerrors.Error = "server refresh timeout is invalid; must be a positive duration"
+
+	// ErrInvalidServerFetchRate is returned when the server fetch rate is
+	// invalid.
+	ErrInvalidServerFetchRate xerrors.Error = "server fetch rate is invalid; must be a positive number"
+
 	// ErrInvalidSitemapURL is returned when the sitemap URL is invalid.
-	ErrInvalidSitemapURL xerrors.Error = "sitemap URL is invalid; must be a valid URL and cannot be an index page"
+	ErrInvalidSitemapURL xerrors.Error = "sitemap URL is invalid; must be a valid URL"
+
+	// ErrInvalidSitemapFormat is returned when the sitemap format is invalid.
+	ErrInvalidSitemapFormat xerrors.Error = "sitemap format is invalid; must be auto, xml, text, rss or atom"
+
+	// ErrInvalidSitemapMaxDepth is returned when the sitemap index depth limit
+	// is invalid.
+	ErrInvalidSitemapMaxDepth xerrors.Error = "sitemap max depth is invalid; must be a positive number"
+
+	// ErrInvalidSitemapSampleSize is returned when the sitemap sample size is
+	// invalid.
+	ErrInvalidSitemapSampleSize xerrors.Error = "sitemap sample size is invalid; must be zero or a positive number"
+
+	// ErrInvalidFilter is returned when a sitemap filter rule is invalid.
+	ErrInvalidFilter xerrors.Error = "sitemap filter is invalid"
+
+	// ErrInvalidNormalize is returned when a sitemap normalization rule is
+	// invalid.
+	ErrInvalidNormalize xerrors.Error = "sitemap normalization is invalid"
+
+	// ErrInvalidSelectionMode is returned when the selection mode is invalid.
+	ErrInvalidSelectionMode xerrors.Error = "selection mode is invalid; must be the name of a registered selector"
+
+	// ErrInvalidVisitorHistory is returned when the visitor history size is
+	// invalid.
+	ErrInvalidVisitorHistory xerrors.Error = "visitor history is invalid; must be between 0 and 256"
+
+	// ErrInvalidVisitorSecret is returned when the visitor secret is too
+	// short.
+	ErrInvalidVisitorSecret xerrors.Error = "visitor secret is invalid; must be at least 32 characters long"
+
+	// ErrInvalidRedirectStatus is returned when the redirect status code is
+	// invalid.
+	ErrInvalidRedirectStatus xerrors.Error = "redirect status is invalid; must be 302, 303 or 307"
+
+	// ErrInvalidSelectionRecencyWindow is returned when the selection recency
+	// window is invalid.
+	ErrInvalidSelectionRecencyWindow xerrors.Error = "selection recency window is invalid; must be a positive duration"
+
+	// ErrInvalidMetricsAddress is returned when the metrics address is
+	// invalid.
+	ErrInvalidMetricsAddress xerrors.Error = "metrics address is invalid; must be HOST:PORT or unix:PATH and differ from the server address"
 )
 
 const (
@@ -52,6 +116,10 @@ const (
 	// server.
 	DefaultMinTLSVersion string = "1.3"
 
+	// DefaultTLSReloadInterval is the default interval between checks for a
+	// renewed TLS certificate.
+	DefaultTLSReloadInterval time.Duration = certificate.DefaultPollInterval
+
 	// DefaultAddress is the default address of the application.
 	DefaultAddress string = ":1997"
 
@@ -61,8 +129,41 @@ const (
 	// DefaultCacheTTL is the default time-to-live of the cache.
 	DefaultCacheTTL time.Duration = 30 * time.Minute
 
+	// DefaultRefreshTimeout is the default maximum amount of time spent
+	// loading a sitemap, including the children of a sitemap index.
+	DefaultRefreshTimeout time.Duration = cache.DefaultRefreshTimeout
+
+	// DefaultFetchRate is the default maximum number of sitemaps downloaded
+	// per second.
+	DefaultFetchRate float64 = fetch.DefaultRateLimit
+
 	// DefaultServiceName is the default name of the service.
 	DefaultServiceName string = sitred.Name
+
+	// DefaultSitemapMaxDepth is the default number of nested sitemap indexes
+	// to follow.
+	DefaultSitemapMaxDepth int = sitemap.DefaultMaxDepth
+
+	// DefaultSitemapFormat is the default format of the sitemap.
+	DefaultSitemapFormat string = string(sitemap.FormatAuto)
+
+	// DefaultSelectionMode is the default way of choosing a random URL.
+	DefaultSelectionMode string = policy.DefaultMode
+
+	// DefaultSelectionRecencyWindow is the default window within which
+	// recently modified URLs are favored.
+	DefaultSelectionRecencyWindow time.Duration = policy.DefaultRecencyWindow
+
+	// DefaultRedirectStatus is the default status code of redirects.
+	DefaultRedirectStatus int = http.StatusFound
+
+	// DefaultRedirectCacheControl is the default Cache-Control header of
+	// redirects.
+	DefaultRedirectCacheControl string = policy.DefaultRedirectCacheControl
+
+	// MinVisitorSecretLength is the minimum length of the secret used to sign
+	// visitor history cookies.
+	MinVisitorSecretLength int = 32
 )
 
 // TLS represents the TLS configuration.
@@ -75,6 +176,14 @@ type TLS struct {
 
 	// Version is the TLS version to use.
 	Version string
+
+	// ReloadInterval is the interval between checks for a renewed certificate.
+	// Zero disables automatic reloading.
+	ReloadInterval time.Duration
+
+	// Disable defines whether the server should serve plain HTTP, for
+	// deployments behind a proxy that already terminates TLS.
+	Disable bool
 }
 
 // Server represents the server configuration.
@@ -82,7 +191,8 @@ type Server struct {
 	// TLS is the TLS configuration.
 	TLS *TLS
 
-	// Address is the address of the application.
+	// Address is the address of the application. Addresses in the
+	// unix:PATH format listen on a Unix domain socket.
 	Address string
 
 	// PID is the path to the PID file.
@@ -91,6 +201,14 @@ type Server struct {
 	// CacheTTL is the TTL of the cache.
 	CacheTTL time.Duration
 
+	// RefreshTimeout is the maximum amount of time spent loading a sitemap,
+	// including the children of a sitemap index.
+	RefreshTimeout time.Duration
+
+	// FetchRate is the maximum number of sitemaps, including the children of
+	// sitemap indexes, downloaded per second.
+	FetchRate float64
+
 	// LogRequests defines whether the application should log requests.
 	LogRequests bool
 }
@@ -106,8 +224,119 @@ type Service struct {
 
 // Sitemap represents the sitemap configuration.
 type Sitemap struct {
-	// URL is the URL of the sitemap.
+	// URL is the URL of the sitemap or sitemap index.
 	URL string
+
+	// Format is the format of the sitemap; either auto, xml, text, rss or
+	// atom.
+	Format string
+
+	// MaxDepth is the maximum number of nested sitemap indexes to follow.
+	MaxDepth int
+
+	// SampleSize is the number of URLs randomly sampled from the sitemap
+	// every time it's loaded, so huge sitemaps can be served with bounded
+	// memory. Zero keeps every URL.
+	SampleSize int
+
+	// Strict rejects XML sitemaps that don't follow the sitemaps protocol,
+	// instead of parsing them leniently.
+	Strict bool
+
+	// Normalize is the set of rules canonicalizing the sitemap's URLs before
+	// they're filtered and deduplicated.
+	Normalize *Normalize
+
+	// Filter is the set of rules deciding which of the sitemap's URLs are
+	// candidates for redirects.
+	Filter *Filter
+
+	// Selection is the configuration of how a random URL is chosen.
+	Selection *Selection
+}
+
+// Selection represents how a random URL is chosen from the sitemap.
+type Selection struct {
+	// Mode is the name of the selector used to choose a URL, such as
+	// uniform, priority, recency, shuffle, round-robin, seeded, or any
+	// mode registered with policy.RegisterMode.
+	Mode string
+
+	// Seed is the seed used by deterministic selectors.
+	Seed string
+
+	// RecencyWindow is the window within which recently modified URLs are
+	// favored in the recency mode.
+	RecencyWindow time.Duration
+}
+
+// Filter represents the rules deciding which sitemap URLs are candidates for
+// redirects. Rules are applied once every time the sitemap is loaded.
+type Filter struct {
+	// Include is the list of glob or regular expression path patterns a URL
+	// must match at least one of. An empty list matches every URL.
+	Include []string
+
+	// Exclude is the list of glob or regular expression path patterns a URL
+	// must not match.
+	Exclude []string
+
+	// Hosts is the list of hosts URLs are allowed on. An empty list allows
+	// every host.
+	Hosts []string
+
+	// StripQuery defines whether the query string should be removed from
+	// every URL.
+	StripQuery bool
+}
+
+// Normalize represents the rules canonicalizing sitemap URLs, on top of the
+// ones always applied, so duplicates can be removed. Rules are applied once
+// every time the sitemap is loaded.
+type Normalize struct {
+	// StripParams is the list of query parameters to remove from every URL,
+	// such as tracking parameters. Names may contain path.Match wildcards,
+	// such as "utm_*".
+	StripParams []string
+
+	// HTTPS defines whether HTTP URLs should be rewritten to HTTPS.
+	HTTPS bool
+
+	// TrailingSlash defines whether URLs that only differ by a trailing
+	// slash are considered duplicates.
+	TrailingSlash bool
+}
+
+// Redirect represents how redirect responses are written.
+type Redirect struct {
+	// CacheControl is the Cache-Control header of redirects.
+	CacheControl string
+
+	// Status is the status code of redirects; either 302, 303 or 307.
+	Status int
+
+	// Page defines whether redirects should include an HTML page with a meta
+	// refresh tag and a link to the target.
+	Page bool
+}
+
+// Visitor represents the configuration of per-visitor state.
+type Visitor struct {
+	// Secret is the secret used to sign visitor history cookies. If empty, a
+	// random secret is generated every time the configuration is loaded.
+	Secret string
+
+	// History is the number of URLs recently served to a visitor that they
+	// aren't redirected to again. Zero disables visitor history.
+	History int
+}
+
+// Metrics represents the configuration of the metrics endpoint.
+type Metrics struct {
+	// Address is the address of a separate listener serving metrics, in the
+	// same format as Server.Address. If empty, metrics are served by the main
+	// server instead.
+	Address string
 }
 
 // Config represents the application configuration.
@@ -118,32 +347,102 @@ type Config struct {
 	// Server is the server configuration.
 	Server *Server
 
-	// Sitemap is the sitemap configuration.
+	// Sitemap is the sitemap configuration. Its URL is used for requests that
+	// don't match any of the Routes, and its other settings are inherited by
+	// every route.
 	Sitemap *Sitemap
+
+	// Redirect is the redirect response configuration.
+	Redirect *Redirect
+
+	// Visitor is the per-visitor state configuration.
+	Visitor *Visitor
+
+	// Metrics is the metrics endpoint configuration.
+	Metrics *Metrics
+
+	// Routes maps hosts and path prefixes to their own sitemaps.
+	Routes []*Route
 }
 
 // Parse parses a cli.Context and returns a Config from it or an error if the
 // Config isn't valid.
+//
+// If the "config" flag points to a configuration file, its settings are used as
+// the base configuration, which environment variables and then flags
+// override.
 func Parse(ctx *cli.Context) (*Config, error) {
+	f, err := readFile(ctx.String("config"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
 	cfg := &Config{
 		Service: &Service{
-			Name:    ctx.String("service-name"),
-			Contact: ctx.String("service-contact"),
+			Name:    value(ctx, "service-name", f.Service.Name, ctx.String),
+			Contact: value(ctx, "service-contact", f.Service.Contact, ctx.String),
 		},
 		Server: &Server{
 			TLS: &TLS{
-				Certificate: ctx.String("tls-certificate"),
-				Key:         ctx.String("tls-key"),
-				Version:     ctx.String("tls-version"),
+				Certificate:    value(ctx, "tls-certificate", f.Server.TLS.Certificate, ctx.String),
+				Key:            value(ctx, "tls-key", f.Server.TLS.Key, ctx.String),
+				Version:        value(ctx, "tls-version", f.Server.TLS.Version, ctx.String),
+				ReloadInterval: durationValue(ctx, "tls-reload-interval", f.Server.TLS.ReloadInterval),
+				Disable:        value(ctx, "tls-disable", f.Server.TLS.Disable, ctx.Bool),
 			},
-			Address:     ctx.String("server-address"),
-			PID:         ctx.String("server-pid"),
-			CacheTTL:    ctx.Duration("server-cache-ttl"),
-			LogRequests: ctx.Bool("server-log-requests"),
+			Address:        value(ctx, "server-address", f.Server.Address, ctx.String),
+			PID:            value(ctx, "server-pid", f.Server.PID, ctx.String),
+			CacheTTL:       durationValue(ctx, "server-cache-ttl", f.Server.CacheTTL),
+			RefreshTimeout: durationValue(ctx, "server-refresh-timeout", f.Server.RefreshTimeout),
+			FetchRate:      value(ctx, "server-fetch-rate", f.Server.FetchRate, ctx.Float64),
+			LogRequests:    value(ctx, "server-access-log", f.Server.AccessLog, ctx.Bool),
 		},
 		Sitemap: &Sitemap{
-			URL: ctx.String("sitemap-url"),
+			URL:        value(ctx, "sitemap-url", f.Sitemap.URL, ctx.String),
+			Format:     value(ctx, "sitemap-format", f.Sitemap.Format, ctx.String),
+			MaxDepth:   value(ctx, "sitemap-max-depth", f.Sitemap.MaxDepth, ctx.Int),
+			SampleSize: value(ctx, "sitemap-sample-size", f.Sitemap.SampleSize, ctx.Int),
+			Strict:     value(ctx, "sitemap-strict", f.Sitemap.Strict, ctx.Bool),
+			Normalize: &Normalize{
+				StripParams:   value(ctx, "normalize-strip-param", f.Sitemap.Normalize.StripParams, ctx.StringSlice),
+				HTTPS:         value(ctx, "normalize-https", f.Sitemap.Normalize.HTTPS, ctx.Bool),
+				TrailingSlash: value(ctx, "normalize-trailing-slash", f.Sitemap.Normalize.TrailingSlash, ctx.Bool),
+			},
+			Filter: &Filter{
+				Include:    value(ctx, "filter-include", f.Sitemap.Filter.Include, ctx.StringSlice),
+				Exclude:    value(ctx, "filter-exclude", f.Sitemap.Filter.Exclude, ctx.StringSlice),
+				Hosts:      value(ctx, "filter-host", f.Sitemap.Filter.Hosts, ctx.StringSlice),
+				StripQuery: value(ctx, "filter-strip-query", f.Sitemap.Filter.StripQuery, ctx.Bool),
+			},
+			Selection: &Selection{
+				Mode:          value(ctx, "selection-mode", f.Sitemap.Selection.Mode, ctx.String),
+				Seed:          value(ctx, "selection-seed", f.Sitemap.Selection.Seed, ctx.String),
+				RecencyWindow: durationValue(ctx, "selection-recency-window", f.Sitemap.Selection.RecencyWindow),
+			},
 		},
+		Redirect: &Redirect{
+			CacheControl: value(ctx, "redirect-cache-control", f.Redirect.CacheControl, ctx.String),
+			Status:       value(ctx, "redirect-status", f.Redirect.Status, ctx.Int),
+			Page:         value(ctx, "redirect-page", f.Redirect.Page, ctx.Bool),
+		},
+		Visitor: &Visitor{
+			Secret:  value(ctx, "visitor-secret", f.Visitor.Secret, ctx.String),
+			History: value(ctx, "visitor-history", f.Visitor.History, ctx.Int),
+		},
+		Metrics: &Metrics{
+			Address: value(ctx, "metrics-address", f.Metrics.Address, ctx.String),
+		},
+	}
+
+	cfg.Routes = f.routes(cfg.Sitemap)
+
+	for _, flagValue := range ctx.StringSlice("sitemap-route") {
+		route, err := ParseRoute(flagValue, cfg.Sitemap)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+
+		cfg.Routes = append(cfg.Routes, route)
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -153,6 +452,23 @@ func Parse(ctx *cli.Context) (*Config, error) {
 	return cfg, nil
 }
 
+// ParsePID returns the path to the PID file from a cli.Context and the
+// configuration file, if any, without requiring the rest of the configuration
+// to be valid.
+func ParsePID(ctx *cli.Context) (string, error) {
+	f, err := readFile(ctx.String("config"))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	pid := value(ctx, "server-pid", f.Server.PID, ctx.String)
+	if pid == "" {
+		return "", fmt.Errorf("%w: %w", ErrInvalidConfig, ErrMissingServerPID)
+	}
+
+	return pid, nil
+}
+
 // Validate checks Config for errors.
 func (cfg *Config) Validate() error {
 	if cfg.Service.Name == "" {
@@ -163,44 +479,204 @@ func (cfg *Config) Validate() error {
 		return ErrMissingServiceContact
 	}
 
-	if cfg.Server.TLS.Certificate == "" {
+	if !cfg.Server.TLS.Disable {
+		if err := cfg.Server.TLS.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Server.Address == "" {
+		return ErrMissingServerAddress
+	}
+
+	if network, address := cfg.Server.Listen(); network == "unix" && address == "" {
+		return ErrInvalidServerAddress
+	}
+
+	if cfg.Server.PID == "" {
+		return ErrMissingServerPID
+	}
+
+	if cfg.Server.CacheTTL <= 0 {
+		return ErrInvalidServerCacheTTL
+	}
+
+	if cfg.Server.RefreshTimeout <= 0 {
+		return ErrInvalidServerRefreshTimeout
+	}
+
+	if cfg.Server.FetchRate <= 0 {
+		return ErrInvalidServerFetchRate
+	}
+
+	if !policy.IsRedirectCode(cfg.Redirect.Status) {
+		return ErrInvalidRedirectStatus
+	}
+
+	if err := cfg.Visitor.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.Metrics.Address != "" {
+		if network, address := cfg.Metrics.Listen(); network == "unix" && address == "" {
+			return ErrInvalidMetricsAddress
+		}
+
+		if cfg.Metrics.Address == cfg.Server.Address {
+			return ErrInvalidMetricsAddress
+		}
+	}
+
+	if cfg.Sitemap.URL == "" && len(cfg.Routes) == 0 {
+		return ErrMissingSitemapURL
+	}
+
+	if cfg.Sitemap.URL != "" {
+		if err := cfg.Sitemap.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return validateRoutes(cfg.Routes)
+}
+
+// Validate checks TLS for errors.
+func (t *TLS) Validate() error {
+	if t.Certificate == "" {
 		return ErrMissingTLSCertificate
 	}
 
-	if cfg.Server.TLS.Key == "" {
+	if t.Key == "" {
 		return ErrMissingTLSKey
 	}
 
-	if cfg.Server.TLS.Version != "1.2" && cfg.Server.TLS.Version != "1.3" {
+	if t.Version != "1.2" && t.Version != "1.3" {
 		return ErrInvalidTLSVersion
 	}
 
-	if cfg.Server.Address == "" {
-		return ErrMissingServerAddress
+	if t.ReloadInterval < 0 {
+		return ErrInvalidTLSReloadInterval
 	}
 
-	if cfg.Server.PID == "" {
-		return ErrMissingServerPID
+	return nil
+}
+
+// Validate checks Visitor for errors.
+func (v *Visitor) Validate() error {
+	if v.History < 0 || v.History > policy.MaxHistorySize {
+		return ErrInvalidVisitorHistory
 	}
 
-	if cfg.Server.CacheTTL == 0 {
-		return ErrInvalidServerCacheTTL
+	if v.Secret != "" && len(v.Secret) < MinVisitorSecretLength {
+		return ErrInvalidVisitorSecret
+	}
+
+	return nil
+}
+
+// Listen returns the network and address the server should listen on, as
+// expected by net.Listen.
+func (s *Server) Listen() (network, address string) {
+	return listenAddress(s.Address)
+}
+
+// Listen returns the network and address the metrics listener should listen
+// on, as expected by net.Listen.
+func (m *Metrics) Listen() (network, address string) {
+	return listenAddress(m.Address)
+}
+
+// listenAddress splits an address in the HOST:PORT or unix:PATH format into
+// the network and address expected by net.Listen.
+func listenAddress(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return "unix", path
 	}
 
-	if cfg.Sitemap.URL == "" {
+	return "tcp", address
+}
+
+// Validate checks Sitemap for errors.
+func (s *Sitemap) Validate() error {
+	if s.URL == "" {
 		return ErrMissingSitemapURL
 	}
 
-	// Checks for the suffix used by Yoast SEO for WordPress. This is a naive
-	// check and only works for that specific case, but it's good enough for
-	// something this early.
-	if strings.HasSuffix(cfg.Sitemap.URL, "sitemap_index.xml") {
+	if _, err := url.Parse(s.URL); err != nil {
 		return ErrInvalidSitemapURL
 	}
 
-	if _, err := url.Parse(cfg.Sitemap.URL); err != nil {
-		return ErrInvalidSitemapURL
+	if _, err := sitemap.ParserFor(sitemap.Format(s.Format), s.Strict); err != nil {
+		return ErrInvalidSitemapFormat
+	}
+
+	if s.MaxDepth < 1 {
+		return ErrInvalidSitemapMaxDepth
+	}
+
+	if s.SampleSize < 0 {
+		return ErrInvalidSitemapSampleSize
+	}
+
+	if _, err := s.Normalize.Compile(); err != nil {
+		return err
+	}
+
+	if _, err := s.Filter.Compile(); err != nil {
+		return err
+	}
+
+	if err := s.Selection.Validate(); err != nil {
+		return err
 	}
 
 	return nil
 }
+
+// Validate checks Selection for errors. A nil Selection is valid.
+func (s *Selection) Validate() error {
+	if s == nil {
+		return nil
+	}
+
+	if s.RecencyWindow <= 0 {
+		return ErrInvalidSelectionRecencyWindow
+	}
+
+	if s.Mode != "" && !policy.IsMode(s.Mode) {
+		return fmt.Errorf("%w: %q", ErrInvalidSelectionMode, s.Mode)
+	}
+
+	return nil
+}
+
+// Compile returns the normalize.Normalizer described by Normalize. A nil
+// Normalize returns a nil normalize.Normalizer, which only applies the rules
+// that are always applied.
+func (n *Normalize) Compile() (*normalize.Normalizer, error) {
+	if n == nil {
+		return nil, nil //nolint:nilnil // A nil normalizer is valid and applies the default rules.
+	}
+
+	compiled, err := normalize.New(n.StripParams, n.HTTPS, n.TrailingSlash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidNormalize, err)
+	}
+
+	return compiled, nil
+}
+
+// Compile returns the filter.Filter described by Filter. A nil Filter returns
+// a nil filter.Filter, which keeps every URL.
+func (f *Filter) Compile() (*filter.Filter, error) {
+	if f == nil {
+		return nil, nil //nolint:nilnil // A nil filter is valid and keeps every URL.
+	}
+
+	compiled, err := filter.New(f.Include, f.Exclude, f.Hosts, f.StripQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+	}
+
+	return compiled, nil
+}
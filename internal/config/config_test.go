@@ -0,0 +1,332 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// parse runs config.Parse against a minimal application with the given
+// command line arguments.
+func parse(t *testing.T, args ...string) (*config.Config, error) {
+	t.Helper()
+
+	var (
+		cfg *config.Config
+		err error
+	)
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config"},
+			&cli.StringFlag{Name: "service-name", Value: config.DefaultServiceName},
+			&cli.StringFlag{Name: "service-contact", Value: "test@example.com"},
+			&cli.StringFlag{Name: "tls-certificate"},
+			&cli.StringFlag{Name: "tls-key"},
+			&cli.StringFlag{Name: "tls-version", Value: config.DefaultMinTLSVersion},
+			&cli.DurationFlag{Name: "tls-reload-interval", Value: config.DefaultTLSReloadInterval},
+			&cli.BoolFlag{Name: "tls-disable"},
+			&cli.StringFlag{Name: "server-address", Value: config.DefaultAddress},
+			&cli.StringFlag{Name: "server-pid", Value: config.DefaultPID},
+			&cli.DurationFlag{Name: "server-cache-ttl", Value: config.DefaultCacheTTL},
+			&cli.DurationFlag{Name: "server-refresh-timeout", Value: config.DefaultRefreshTimeout},
+			&cli.Float64Flag{Name: "server-fetch-rate", Value: config.DefaultFetchRate},
+			&cli.BoolFlag{Name: "server-access-log"},
+			&cli.StringFlag{Name: "sitemap-url"},
+			&cli.StringSliceFlag{Name: "sitemap-route"},
+			&cli.StringFlag{Name: "sitemap-format", Value: config.DefaultSitemapFormat},
+			&cli.IntFlag{Name: "sitemap-max-depth", Value: config.DefaultSitemapMaxDepth},
+			&cli.IntFlag{Name: "sitemap-sample-size"},
+			&cli.BoolFlag{Name: "sitemap-strict"},
+			&cli.StringSliceFlag{Name: "normalize-strip-param"},
+			&cli.BoolFlag{Name: "normalize-https"},
+			&cli.BoolFlag{Name: "normalize-trailing-slash"},
+			&cli.StringSliceFlag{Name: "filter-include"},
+			&cli.StringSliceFlag{Name: "filter-exclude"},
+			&cli.StringSliceFlag{Name: "filter-host"},
+			&cli.BoolFlag{Name: "filter-strip-query"},
+			&cli.StringFlag{Name: "selection-mode", Value: config.DefaultSelectionMode},
+			&cli.StringFlag{Name: "selection-seed"},
+			&cli.StringFlag{Name: "redirect-cache-control", Value: config.DefaultRedirectCacheControl},
+			&cli.IntFlag{Name: "redirect-status", Value: config.DefaultRedirectStatus},
+			&cli.BoolFlag{Name: "redirect-page"},
+			&cli.StringFlag{Name: "visitor-secret"},
+			&cli.IntFlag{Name: "visitor-history"},
+			&cli.DurationFlag{Name: "selection-recency-window", Value: config.DefaultSelectionRecencyWindow},
+			&cli.StringFlag{Name: "metrics-address"},
+		},
+		Action: func(ctx *cli.Context) error {
+			cfg, err = config.Parse(ctx)
+
+			return nil
+		},
+	}
+
+	if runErr := app.Run(append([]string{"sitredctl"}, args...)); runErr != nil {
+		t.Fatalf("could not run application: %v", runErr)
+	}
+
+	return cfg, err
+}
+
+func TestParse_File(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sitred.toml")
+
+	err := os.WriteFile(path, []byte(`
+[server]
+cache-ttl = "1h"
+refresh-timeout = "10m"
+fetch-rate = 20
+address = ":8080"
+
+[server.tls]
+certificate = "/etc/sitred/cert.pem"
+key = "/etc/sitred/key.pem"
+
+[sitemap]
+url = "https://example.com/sitemap.xml"
+max-depth = 2
+
+[sitemap.normalize]
+strip-params = ["utm_*"]
+
+[sitemap.filter]
+exclude = ["/tag/**"]
+strip-query = true
+
+[sitemap.selection]
+mode = "recency"
+recency-window = "720h"
+
+[[route]]
+host = "Blog.example.com"
+prefix = "/posts/"
+url = "https://blog.example.com/feed.xml"
+format = "rss"
+sample-size = 500
+strict = true
+
+[route.normalize]
+https = true
+
+[route.filter]
+include = ["/posts/*"]
+`), 0o600)
+	if err != nil {
+		t.Fatalf("could not write configuration file: %v", err)
+	}
+
+	cfg, err := parse(t, "--config", path, "--server-address", ":9090")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if cfg.Server.CacheTTL != time.Hour {
+		t.Errorf("Parse() CacheTTL = %v, want %v", cfg.Server.CacheTTL, time.Hour)
+	}
+
+	if cfg.Server.RefreshTimeout != 10*time.Minute || cfg.Server.FetchRate != 20 {
+		t.Errorf("Parse() RefreshTimeout, FetchRate = %v, %v, want file settings", cfg.Server.RefreshTimeout, cfg.Server.FetchRate)
+	}
+
+	if cfg.Server.Address != ":9090" {
+		t.Errorf("Parse() Address = %q, want flag to override file", cfg.Server.Address)
+	}
+
+	if cfg.Server.TLS.Version != config.DefaultMinTLSVersion {
+		t.Errorf("Parse() TLS.Version = %q, want default %q", cfg.Server.TLS.Version, config.DefaultMinTLSVersion)
+	}
+
+	if len(cfg.Routes) != 1 {
+		t.Fatalf("Parse() got %d routes, want 1", len(cfg.Routes))
+	}
+
+	route := cfg.Routes[0]
+
+	if route.Name() != "blog.example.com/posts" {
+		t.Errorf("Parse() route name = %q, want %q", route.Name(), "blog.example.com/posts")
+	}
+
+	if route.Sitemap.Format != "rss" || route.Sitemap.MaxDepth != 2 || route.Sitemap.SampleSize != 500 || !route.Sitemap.Strict {
+		t.Errorf("Parse() route sitemap = %+v, want rss format, sample size, strict mode and inherited max depth", route.Sitemap)
+	}
+
+	if cfg.Sitemap.SampleSize != 0 || cfg.Sitemap.Strict {
+		t.Errorf("Parse() sitemap = %+v, want no sample size and lenient mode", cfg.Sitemap)
+	}
+
+	if len(cfg.Sitemap.Filter.Exclude) != 1 || !cfg.Sitemap.Filter.StripQuery {
+		t.Errorf("Parse() sitemap filter = %+v, want file settings", cfg.Sitemap.Filter)
+	}
+
+	if route.Sitemap.Selection.Mode != "recency" || route.Sitemap.Selection.RecencyWindow != 720*time.Hour {
+		t.Errorf("Parse() route selection = %+v, want inherited file settings", route.Sitemap.Selection)
+	}
+
+	routeNormalize := route.Sitemap.Normalize
+	if len(routeNormalize.StripParams) != 1 || !routeNormalize.HTTPS || cfg.Sitemap.Normalize.HTTPS {
+		t.Errorf("Parse() route normalize = %+v, want https and inherited settings", routeNormalize)
+	}
+
+	routeFilter := route.Sitemap.Filter
+	if len(routeFilter.Include) != 1 || len(routeFilter.Exclude) != 1 || !routeFilter.StripQuery {
+		t.Errorf("Parse() route filter = %+v, want include and inherited settings", routeFilter)
+	}
+}
+
+func TestParse_FileErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{
+			name:    "unknown key",
+			content: "[sitemap]\nurl = \"https://example.com/sitemap.xml\"\nurls = []\n",
+			wantErr: config.ErrUnknownFileKey,
+		},
+		{
+			name:    "invalid syntax",
+			content: "[sitemap\n",
+			wantErr: config.ErrReadFile,
+		},
+		{
+			name:    "invalid value",
+			content: "[server.tls]\ncertificate = \"cert.pem\"\nkey = \"key.pem\"\nversion = \"1.1\"\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n",
+			wantErr: config.ErrInvalidTLSVersion,
+		},
+		{
+			name:    "invalid filter",
+			content: "[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n[sitemap.filter]\nexclude = [\"re:(\"]\n",
+			wantErr: config.ErrInvalidFilter,
+		},
+		{
+			name:    "invalid normalize parameter",
+			content: "[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n[sitemap.normalize]\nstrip-params = [\"[\"]\n",
+			wantErr: config.ErrInvalidNormalize,
+		},
+		{
+			name:    "invalid selection mode",
+			content: "[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n[sitemap.selection]\nmode = \"popularity\"\n",
+			wantErr: config.ErrInvalidSelectionMode,
+		},
+		{
+			name:    "invalid redirect status",
+			content: "[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n[redirect]\nstatus = 301\n",
+			wantErr: config.ErrInvalidRedirectStatus,
+		},
+		{
+			name:    "short visitor secret",
+			content: "[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n[visitor]\nhistory = 10\nsecret = \"hunter2\"\n",
+			wantErr: config.ErrInvalidVisitorSecret,
+		},
+		{
+			name:    "invalid refresh timeout",
+			content: "[server]\nrefresh-timeout = \"0s\"\n[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n",
+			wantErr: config.ErrInvalidServerRefreshTimeout,
+		},
+		{
+			name:    "invalid fetch rate",
+			content: "[server]\nfetch-rate = 0\n[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n",
+			wantErr: config.ErrInvalidServerFetchRate,
+		},
+		{
+			name:    "metrics address same as server address",
+			content: "[server]\naddress = \":8080\"\n[server.tls]\ndisable = true\n[sitemap]\nurl = \"https://example.com/sitemap.xml\"\n[metrics]\naddress = \":8080\"\n",
+			wantErr: config.ErrInvalidMetricsAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "sitred.toml")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("could not write configuration file: %v", err)
+			}
+
+			_, err := parse(t, "--config", path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !errors.Is(err, config.ErrInvalidConfig) {
+				t.Errorf("Parse() error = %v, want it to wrap %v", err, config.ErrInvalidConfig)
+			}
+		})
+	}
+}
+
+func TestParse_Listen(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantNetwork string
+		wantAddress string
+		wantErr     error
+	}{
+		{
+			name:    "TLS without certificate",
+			args:    []string{"--server-address", ":8080"},
+			wantErr: config.ErrMissingTLSCertificate,
+		},
+		{
+			name:        "TLS disabled skips certificate validation",
+			args:        []string{"--tls-disable", "--tls-version", "1.1", "--server-address", ":8080"},
+			wantNetwork: "tcp",
+			wantAddress: ":8080",
+		},
+		{
+			name:        "Unix domain socket",
+			args:        []string{"--tls-disable", "--server-address", "unix:/run/sitred/sitred.sock"},
+			wantNetwork: "unix",
+			wantAddress: "/run/sitred/sitred.sock",
+		},
+		{
+			name:    "Unix domain socket without path",
+			args:    []string{"--tls-disable", "--server-address", "unix:"},
+			wantErr: config.ErrInvalidServerAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, err := parse(t, append(tt.args, "--sitemap-url", "https://example.com/sitemap.xml")...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			network, address := cfg.Server.Listen()
+			if network != tt.wantNetwork || address != tt.wantAddress {
+				t.Errorf("Listen() = %q, %q, want %q, %q", network, address, tt.wantNetwork, tt.wantAddress)
+			}
+		})
+	}
+}
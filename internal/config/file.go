@@ -0,0 +1,341 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// ErrReadFile is returned when the configuration file cannot be read.
+	ErrReadFile xerrors.Error = "failed to read configuration file"
+
+	// ErrUnknownFileKey is returned when the configuration file contains a key
+	// that isn't part of the schema.
+	ErrUnknownFileKey xerrors.Error = "unknown key in configuration file"
+)
+
+// duration is a time.Duration that can be decoded from a string such as "30m"
+// in the configuration file.
+type duration time.Duration
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	*d = duration(parsed)
+
+	return nil
+}
+
+// fileTLS represents the [server.tls] table of the configuration file.
+type fileTLS struct {
+	Certificate    *string   `toml:"certificate"`
+	Key            *string   `toml:"key"`
+	Version        *string   `toml:"version"`
+	ReloadInterval *duration `toml:"reload-interval"`
+	Disable        *bool     `toml:"disable"`
+}
+
+// fileServer represents the [server] table of the configuration file.
+type fileServer struct {
+	TLS            *fileTLS  `toml:"tls"`
+	Address        *string   `toml:"address"`
+	PID            *string   `toml:"pid"`
+	CacheTTL       *duration `toml:"cache-ttl"`
+	RefreshTimeout *duration `toml:"refresh-timeout"`
+	FetchRate      *float64  `toml:"fetch-rate"`
+	AccessLog      *bool     `toml:"access-log"`
+}
+
+// fileService represents the [service] table of the configuration file.
+type fileService struct {
+	Name    *string `toml:"name"`
+	Contact *string `toml:"contact"`
+}
+
+// fileFilter represents the [sitemap.filter] table of the configuration file.
+type fileFilter struct {
+	Include    *[]string `toml:"include"`
+	Exclude    *[]string `toml:"exclude"`
+	Hosts      *[]string `toml:"hosts"`
+	StripQuery *bool     `toml:"strip-query"`
+}
+
+// fileNormalize represents the [sitemap.normalize] table of the configuration
+// file.
+type fileNormalize struct {
+	StripParams   *[]string `toml:"strip-params"`
+	HTTPS         *bool     `toml:"https"`
+	TrailingSlash *bool     `toml:"trailing-slash"`
+}
+
+// fileSelection represents the [sitemap.selection] table of the
+// configuration file.
+type fileSelection struct {
+	Mode          *string   `toml:"mode"`
+	Seed          *string   `toml:"seed"`
+	RecencyWindow *duration `toml:"recency-window"`
+}
+
+// fileRedirect represents the [redirect] table of the configuration file.
+type fileRedirect struct {
+	CacheControl *string `toml:"cache-control"`
+	Status       *int    `toml:"status"`
+	Page         *bool   `toml:"page"`
+}
+
+// fileVisitor represents the [visitor] table of the configuration file.
+type fileVisitor struct {
+	Secret  *string `toml:"secret"`
+	History *int    `toml:"history"`
+}
+
+// fileMetrics represents the [metrics] table of the configuration file.
+type fileMetrics struct {
+	Address *string `toml:"address"`
+}
+
+// fileSitemap represents the [sitemap] table of the configuration file.
+type fileSitemap struct {
+	Normalize  *fileNormalize `toml:"normalize"`
+	Filter     *fileFilter    `toml:"filter"`
+	Selection  *fileSelection `toml:"selection"`
+	URL        *string        `toml:"url"`
+	Format     *string        `toml:"format"`
+	MaxDepth   *int           `toml:"max-depth"`
+	SampleSize *int           `toml:"sample-size"`
+	Strict     *bool          `toml:"strict"`
+}
+
+// fileRoute represents a [[route]] table of the configuration file.
+type fileRoute struct {
+	fileSitemap
+
+	Host   string `toml:"host"`
+	Prefix string `toml:"prefix"`
+}
+
+// file represents the configuration file. Every field is optional, and fields
+// that are set are overridden by environment variables and flags.
+type file struct {
+	Service  *fileService  `toml:"service"`
+	Server   *fileServer   `toml:"server"`
+	Sitemap  *fileSitemap  `toml:"sitemap"`
+	Redirect *fileRedirect `toml:"redirect"`
+	Visitor  *fileVisitor  `toml:"visitor"`
+	Metrics  *fileMetrics  `toml:"metrics"`
+	Routes   []*fileRoute  `toml:"route"`
+}
+
+// readFile reads the configuration file at path. An empty path returns an
+// empty configuration.
+func readFile(path string) (*file, error) {
+	f := &file{
+		Service: &fileService{},
+		Server: &fileServer{
+			TLS: &fileTLS{},
+		},
+		Sitemap: &fileSitemap{
+			Normalize: &fileNormalize{},
+			Filter:    &fileFilter{},
+			Selection: &fileSelection{},
+		},
+		Redirect: &fileRedirect{},
+		Visitor:  &fileVisitor{},
+		Metrics:  &fileMetrics{},
+	}
+
+	if path == "" {
+		return f, nil
+	}
+
+	meta, err := toml.DecodeFile(path, f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFile, err)
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFileKey, strings.Join(keys, ", "))
+	}
+
+	// Decoding an empty table leaves the pointer nil.
+	if f.Server.TLS == nil {
+		f.Server.TLS = &fileTLS{}
+	}
+
+	if f.Sitemap.Normalize == nil {
+		f.Sitemap.Normalize = &fileNormalize{}
+	}
+
+	if f.Sitemap.Filter == nil {
+		f.Sitemap.Filter = &fileFilter{}
+	}
+
+	if f.Sitemap.Selection == nil {
+		f.Sitemap.Selection = &fileSelection{}
+	}
+
+	return f, nil
+}
+
+// routes returns the routes defined in the configuration file, inheriting
+// unset settings from defaults.
+func (f *file) routes(defaults *Sitemap) []*Route {
+	routes := make([]*Route, 0, len(f.Routes))
+
+	for _, r := range f.Routes {
+		site := *defaults
+		site.URL = ""
+
+		if r.URL != nil {
+			site.URL = *r.URL
+		}
+
+		if r.Format != nil {
+			site.Format = *r.Format
+		}
+
+		if r.MaxDepth != nil {
+			site.MaxDepth = *r.MaxDepth
+		}
+
+		if r.SampleSize != nil {
+			site.SampleSize = *r.SampleSize
+		}
+
+		if r.Strict != nil {
+			site.Strict = *r.Strict
+		}
+
+		if r.Normalize != nil {
+			site.Normalize = r.Normalize.merge(defaults.Normalize)
+		}
+
+		if r.Filter != nil {
+			site.Filter = r.Filter.merge(defaults.Filter)
+		}
+
+		if r.Selection != nil {
+			site.Selection = r.Selection.merge(defaults.Selection)
+		}
+
+		route := &Route{
+			Sitemap: &site,
+			Host:    strings.ToLower(r.Host),
+		}
+
+		if prefix := strings.Trim(r.Prefix, "/"); prefix != "" {
+			route.Prefix = "/" + prefix
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// merge returns a copy of defaults with the settings from the normalize table
+// applied on top of it.
+func (n *fileNormalize) merge(defaults *Normalize) *Normalize {
+	merged := &Normalize{}
+
+	if defaults != nil {
+		*merged = *defaults
+	}
+
+	if n.StripParams != nil {
+		merged.StripParams = *n.StripParams
+	}
+
+	if n.HTTPS != nil {
+		merged.HTTPS = *n.HTTPS
+	}
+
+	if n.TrailingSlash != nil {
+		merged.TrailingSlash = *n.TrailingSlash
+	}
+
+	return merged
+}
+
+// merge returns a copy of defaults with the settings from the filter table
+// applied on top of it.
+func (f *fileFilter) merge(defaults *Filter) *Filter {
+	merged := &Filter{}
+
+	if defaults != nil {
+		*merged = *defaults
+	}
+
+	if f.Include != nil {
+		merged.Include = *f.Include
+	}
+
+	if f.Exclude != nil {
+		merged.Exclude = *f.Exclude
+	}
+
+	if f.Hosts != nil {
+		merged.Hosts = *f.Hosts
+	}
+
+	if f.StripQuery != nil {
+		merged.StripQuery = *f.StripQuery
+	}
+
+	return merged
+}
+
+// merge returns a copy of defaults with the settings from the selection table
+// applied on top of it.
+func (s *fileSelection) merge(defaults *Selection) *Selection {
+	merged := &Selection{}
+
+	if defaults != nil {
+		*merged = *defaults
+	}
+
+	if s.Mode != nil {
+		merged.Mode = *s.Mode
+	}
+
+	if s.Seed != nil {
+		merged.Seed = *s.Seed
+	}
+
+	if s.RecencyWindow != nil {
+		merged.RecencyWindow = time.Duration(*s.RecencyWindow)
+	}
+
+	return merged
+}
+
+// value returns the value of a flag if it was set on the command line or
+// through an environment variable, the value from the configuration file if
+// one was set, or the flag's default value otherwise.
+func value[T any](ctx *cli.Context, name string, fileValue *T, get func(name string) T) T {
+	if fileValue != nil && !ctx.IsSet(name) {
+		return *fileValue
+	}
+
+	return get(name)
+}
+
+// durationValue is like value, but for durations.
+func durationValue(ctx *cli.Context, name string, fileValue *duration) time.Duration {
+	return value(ctx, name, (*time.Duration)(fileValue), ctx.Duration)
+}
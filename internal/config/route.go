@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+const (
+	// ErrInvalidRoute is returned when a sitemap route is invalid.
+	ErrInvalidRoute xerrors.Error = "sitemap route is invalid; must be in the [HOST][/PREFIX]=URL format"
+
+	// ErrDuplicateRoute is returned when two sitemap routes match the same
+	// host and path prefix.
+	ErrDuplicateRoute xerrors.Error = "sitemap route is duplicated"
+)
+
+// Route maps incoming requests to a sitemap based on their Host header and URL
+// path.
+type Route struct {
+	// Sitemap is the sitemap used for requests matching the route.
+	Sitemap *Sitemap
+
+	// Host is the host the route matches. An empty host matches any host.
+	Host string
+
+	// Prefix is the URL path prefix the route matches. An empty prefix matches
+	// any path.
+	Prefix string
+}
+
+// Name returns a human-readable name for the route.
+func (r *Route) Name() string {
+	if r.Host == "" && r.Prefix == "" {
+		return "default"
+	}
+
+	return r.Host + r.Prefix
+}
+
+// ParseRoute parses a route in the [HOST][/PREFIX]=URL format, such as
+// "blog.example.com=https://blog.example.com/sitemap.xml" or
+// "/docs=https://docs.example.com/sitemap.xml". Settings other than the
+// sitemap URL are copied from defaults.
+func ParseRoute(value string, defaults *Sitemap) (*Route, error) {
+	target, uri, ok := strings.Cut(value, "=")
+	if !ok || uri == "" || target == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRoute, value)
+	}
+
+	host, prefix, _ := strings.Cut(target, "/")
+
+	site := *defaults
+	site.URL = uri
+
+	route := &Route{
+		Sitemap: &site,
+		Host:    strings.ToLower(host),
+	}
+
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		route.Prefix = "/" + prefix
+	}
+
+	return route, nil
+}
+
+// validateRoutes checks a list of routes for errors.
+func validateRoutes(routes []*Route) error {
+	seen := make(map[string]struct{}, len(routes))
+
+	for _, route := range routes {
+		if route.Sitemap == nil {
+			return fmt.Errorf("%w: %s", ErrMissingSitemapURL, route.Name())
+		}
+
+		if route.Prefix != "" && !strings.HasPrefix(route.Prefix, "/") {
+			return fmt.Errorf("%w: %s", ErrInvalidRoute, route.Name())
+		}
+
+		if _, ok := seen[route.Name()]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateRoute, route.Name())
+		}
+
+		seen[route.Name()] = struct{}{}
+
+		if err := route.Sitemap.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", err, route.Name())
+		}
+	}
+
+	return nil
+}
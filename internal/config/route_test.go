@@ -0,0 +1,86 @@
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/config"
+)
+
+func TestParseRoute(t *testing.T) {
+	t.Parallel()
+
+	defaults := &config.Sitemap{
+		URL:      "https://example.com/sitemap.xml",
+		Format:   "auto",
+		MaxDepth: 3,
+	}
+
+	tests := []struct {
+		name       string
+		value      string
+		wantHost   string
+		wantPrefix string
+		wantURL    string
+		wantErr    error
+	}{
+		{
+			name:     "host",
+			value:    "Blog.example.com=https://blog.example.com/sitemap.xml",
+			wantHost: "blog.example.com",
+			wantURL:  "https://blog.example.com/sitemap.xml",
+		},
+		{
+			name:       "prefix",
+			value:      "/docs/=https://example.com/docs/sitemap.xml",
+			wantPrefix: "/docs",
+			wantURL:    "https://example.com/docs/sitemap.xml",
+		},
+		{
+			name:       "host and prefix",
+			value:      "example.com/blog=https://example.com/blog/sitemap.xml?a=b",
+			wantHost:   "example.com",
+			wantPrefix: "/blog",
+			wantURL:    "https://example.com/blog/sitemap.xml?a=b",
+		},
+		{
+			name:    "missing URL",
+			value:   "example.com=",
+			wantErr: config.ErrInvalidRoute,
+		},
+		{
+			name:    "missing target",
+			value:   "https://example.com/sitemap.xml",
+			wantErr: config.ErrInvalidRoute,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := config.ParseRoute(tt.value, defaults)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Host != tt.wantHost || got.Prefix != tt.wantPrefix || got.Sitemap.URL != tt.wantURL {
+				t.Errorf(
+					"ParseRoute() = {%q, %q, %q}, want {%q, %q, %q}",
+					got.Host, got.Prefix, got.Sitemap.URL,
+					tt.wantHost, tt.wantPrefix, tt.wantURL,
+				)
+			}
+
+			if got.Sitemap.MaxDepth != defaults.MaxDepth || got.Sitemap.Format != defaults.Format {
+				t.Errorf("ParseRoute() did not inherit defaults: %+v", got.Sitemap)
+			}
+		})
+	}
+}
@@ -4,4 +4,26 @@ package endpoint
 const (
 	// Root is the endpoint for the root handler.
 	Root string = "/"
+
+	// Daily is the endpoint for the URL of the day.
+	Daily string = "/daily"
+
+	// Hourly is the endpoint for the URL of the hour.
+	Hourly string = "/hourly"
+
+	// Healthz is the liveness endpoint.
+	Healthz string = "/healthz"
+
+	// Readyz is the readiness endpoint.
+	Readyz string = "/readyz"
+
+	// Status is the endpoint reporting the state of every sitemap.
+	Status string = "/status"
+
+	// Metrics is the endpoint serving metrics in the Prometheus text
+	// exposition format.
+	Metrics string = "/metrics"
+
+	// APIRandom is the endpoint returning random URLs as JSON.
+	APIRandom string = "/api/random"
 )
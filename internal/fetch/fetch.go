@@ -5,27 +5,75 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"git.sr.ht/~jamesponddotco/httpx-go"
 	"git.sr.ht/~jamesponddotco/sitred"
 	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
 	"golang.org/x/time/rate"
 )
 
-// ErrFetchData is returned when the client fails to fetch data from a URL.
-const ErrFetchData xerrors.Error = "failed to fetch data"
+const (
+	// ErrFetchData is returned when the client fails to fetch data from a URL.
+	ErrFetchData xerrors.Error = "failed to fetch data"
+
+	// ErrNotModified is returned when the server reports that the data hasn't
+	// changed since the last time it was fetched.
+	ErrNotModified xerrors.Error = "data not modified"
+)
+
+// DefaultRateLimit is the default maximum number of requests per second a
+// Client makes.
+const DefaultRateLimit = 2
+
+// Validator holds the cache validators returned by the server for a URL, used
+// to make conditional requests.
+type Validator struct {
+	// ETag is the value of the ETag header.
+	ETag string
+
+	// LastModified is the value of the Last-Modified header.
+	LastModified string
+}
+
+// ValidatorOf returns the cache validators of a response, if any.
+func ValidatorOf(resp *http.Response) Validator {
+	return Validator{
+		ETag:         resp.Header.Get(xhttp.ETag),
+		LastModified: resp.Header.Get(xhttp.LastModified),
+	}
+}
+
+// IsZero reports whether v holds no validators.
+func (v Validator) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
 
 // Client represents a client that can fetch data from a URL.
 type Client struct {
 	// httpc is the underlying HTTP client used to fetch data.
 	httpc *httpx.Client
+
+	// limiter limits the rate of requests, including retries.
+	limiter *rate.Limiter
 }
 
-// New creates a new client that can fetch data from a URL.
-func New(serviceName, serviceContact string) *Client {
+// New creates a new client that can fetch data from a URL, making at most
+// rateLimit requests per second. If rateLimit isn't positive,
+// DefaultRateLimit is used.
+func New(serviceName, serviceContact string, rateLimit float64) *Client {
+	if rateLimit <= 0 {
+		rateLimit = DefaultRateLimit
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(rateLimit), 1)
+
 	return &Client{
+		limiter: limiter,
 		httpc: &httpx.Client{
-			RateLimiter: rate.NewLimiter(rate.Limit(2), 1),
+			// The underlying client only applies the rate limiter to retries.
+			RateLimiter: limiter,
 			RetryPolicy: httpx.DefaultRetryPolicy(),
 			UserAgent: &httpx.UserAgent{
 				Token:   serviceName,
@@ -39,14 +87,71 @@ func New(serviceName, serviceContact string) *Client {
 
 // Remote fetches data from a URL and returns it as a raw http.Response.
 func (c *Client) Remote(ctx context.Context, uri string) (*http.Response, error) {
-	resp, err := c.httpc.Get(ctx, uri)
+	return c.RemoteIfModified(ctx, uri, Validator{})
+}
+
+// RemoteIfModified is like Remote, but makes the request conditional on the
+// validators of a previous response for the same URL, and returns
+// ErrNotModified if the server replies with 304 Not Modified.
+//
+// The Client doesn't remember validators itself, as the caller is the one
+// holding the copy a 304 Not Modified response refers to.
+func (c *Client) RemoteIfModified(ctx context.Context, uri string, v Validator) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetchData, err)
+	}
+
+	if v.ETag != "" {
+		req.Header.Set(xhttp.IfNoneMatch, v.ETag)
+	}
+
+	if v.LastModified != "" {
+		req.Header.Set(xhttp.IfModifiedSince, v.LastModified)
+	}
+
+	if err = c.wait(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetchData, err)
+	}
+
+	resp, err := c.httpc.Do(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrFetchData, err)
 	}
 
+	if resp.StatusCode == http.StatusNotModified && !v.IsZero() {
+		resp.Body.Close()
+
+		return nil, ErrNotModified
+	}
+
 	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
 		return nil, fmt.Errorf("%w: %s", ErrFetchData, resp.Status)
 	}
 
 	return resp, nil
 }
+
+// wait blocks until the rate limit allows another request, or until ctx is
+// done. Unlike rate.Limiter.Wait, it doesn't give up early when the wait would
+// outlast the deadline of ctx, so callers can tell the request timed out from
+// ctx.Err().
+func (c *Client) wait(ctx context.Context) error {
+	var (
+		reservation = c.limiter.Reserve()
+		timer       = time.NewTimer(reservation.Delay())
+	)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+
+		return fmt.Errorf("%w", ctx.Err())
+	}
+}
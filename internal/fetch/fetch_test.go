@@ -3,7 +3,11 @@ package fetch_test
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
 )
@@ -11,7 +15,7 @@ import (
 func TestClient_Remote(t *testing.T) {
 	t.Parallel()
 
-	client := fetch.New("TestService", "test@example.com")
+	client := fetch.New("TestService", "test@example.com", 0)
 
 	tests := []struct {
 		name          string
@@ -61,3 +65,90 @@ func TestClient_Remote(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_RemoteConditional(t *testing.T) {
+	t.Parallel()
+
+	const etag = `"v1"`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte("data"))
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		ctx    = context.Background()
+		client = fetch.New("TestService", "test@example.com", 0)
+	)
+
+	resp, err := client.Remote(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("first fetch: unexpected error: %v", err)
+	}
+
+	resp.Body.Close()
+
+	validator := fetch.ValidatorOf(resp)
+	if validator.ETag != etag {
+		t.Fatalf("ValidatorOf() ETag = %q, want %q", validator.ETag, etag)
+	}
+
+	if _, err = client.RemoteIfModified(ctx, srv.URL, validator); !errors.Is(err, fetch.ErrNotModified) {
+		t.Fatalf("conditional fetch: expected error %v, got %v", fetch.ErrNotModified, err)
+	}
+
+	if errors.Is(err, fetch.ErrFetchData) {
+		t.Errorf("conditional fetch: %v must not be a %v", err, fetch.ErrFetchData)
+	}
+
+	// The client doesn't remember validators, so plain requests are never
+	// conditional.
+	resp, err = client.Remote(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("second fetch: unexpected error: %v", err)
+	}
+
+	resp.Body.Close()
+}
+
+func TestClient_RemoteRateLimit(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		_, _ = w.Write([]byte("data"))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := fetch.New("TestService", "test@example.com", 1)
+
+	resp, err := client.Remote(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("first fetch: unexpected error: %v", err)
+	}
+
+	resp.Body.Close()
+
+	// The next request isn't allowed for another second, so it must wait
+	// until the context times out rather than be sent right away.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err = client.Remote(ctx, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second fetch: expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+}
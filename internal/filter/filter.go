@@ -0,0 +1,276 @@
+// Package filter implements the include and exclude rules that decide which
+// sitemap URLs are candidates for redirects.
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+// ErrInvalidPattern is returned when a filter pattern cannot be compiled.
+const ErrInvalidPattern xerrors.Error = "invalid filter pattern"
+
+// RegexPrefix is the prefix that marks a pattern as a regular expression.
+// Patterns without it are globs.
+const RegexPrefix = "re:"
+
+// Names of the rules reported in Count when they don't come from a pattern.
+const (
+	RuleInvalid    = "invalid URL"
+	RuleHost       = "host not allowed"
+	RuleNotInclude = "no include pattern matched"
+)
+
+// Pattern matches URL paths against a glob or a regular expression.
+//
+// In globs, "*" matches any sequence of characters except "/", "**" matches
+// any sequence of characters including "/", and "?" matches any single
+// character except "/". Regular expressions are prefixed with "re:" and are
+// unanchored.
+type Pattern struct {
+	re  *regexp.Regexp
+	raw string
+}
+
+// ParsePattern compiles a glob or regular expression pattern.
+func ParsePattern(raw string) (*Pattern, error) {
+	expr, ok := strings.CutPrefix(raw, RegexPrefix)
+	if !ok {
+		expr = globToRegexp(raw)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidPattern, raw, err)
+	}
+
+	return &Pattern{
+		re:  re,
+		raw: raw,
+	}, nil
+}
+
+// Match reports whether the path matches the pattern.
+func (p *Pattern) Match(path string) bool {
+	return p.re.MatchString(path)
+}
+
+// String returns the pattern as it was given to ParsePattern.
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// Count is the number of URLs a rule filtered out.
+type Count struct {
+	// Rule is the pattern or the name of the rule.
+	Rule string
+
+	// Filtered is the number of URLs removed by the rule.
+	Filtered int
+}
+
+// Filter decides which URLs are candidates for redirects.
+type Filter struct {
+	hosts      map[string]struct{}
+	include    []*Pattern
+	exclude    []*Pattern
+	stripQuery bool
+}
+
+// New returns a new Filter.
+//
+// If include isn't empty, only URLs whose path matches at least one of its
+// patterns are kept. URLs whose path matches any of the exclude patterns are
+// removed. If hosts isn't empty, only URLs on one of those hosts are kept. If
+// stripQuery is true, the query string is removed from every URL kept.
+func New(include, exclude, hosts []string, stripQuery bool) (*Filter, error) {
+	f := &Filter{
+		hosts:      make(map[string]struct{}, len(hosts)),
+		include:    make([]*Pattern, 0, len(include)),
+		exclude:    make([]*Pattern, 0, len(exclude)),
+		stripQuery: stripQuery,
+	}
+
+	for _, raw := range include {
+		p, err := ParsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		f.include = append(f.include, p)
+	}
+
+	for _, raw := range exclude {
+		p, err := ParsePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		f.exclude = append(f.exclude, p)
+	}
+
+	for _, host := range hosts {
+		f.hosts[strings.ToLower(host)] = struct{}{}
+	}
+
+	return f, nil
+}
+
+// IsZero reports whether the filter has no rules, in which case Apply returns
+// its input unchanged.
+func (f *Filter) IsZero() bool {
+	return f == nil || (len(f.hosts) == 0 && len(f.include) == 0 && len(f.exclude) == 0 && !f.stripQuery)
+}
+
+// Apply returns the URLs that pass the filter, along with the number of URLs
+// each rule filtered out. Rules that didn't filter out any URL are omitted
+// from the counts.
+func (f *Filter) Apply(urls []sitemap.URL) ([]sitemap.URL, []Count) {
+	if f.IsZero() {
+		return urls, nil
+	}
+
+	kept := make([]sitemap.URL, 0, len(urls))
+
+	walk, counts := f.Walk(func(u sitemap.URL) error {
+		kept = append(kept, u)
+
+		return nil
+	})
+
+	for _, u := range urls {
+		_ = walk(u)
+	}
+
+	return kept, counts()
+}
+
+// Walk returns a sitemap.WalkFunc that calls fn for every URL that passes the
+// filter, for use when URLs are streamed rather than collected in a slice. The
+// second function returns the number of URLs each rule filtered out so far,
+// like Apply.
+func (f *Filter) Walk(fn sitemap.WalkFunc) (walk sitemap.WalkFunc, counts func() []Count) {
+	if f.IsZero() {
+		return fn, func() []Count { return nil }
+	}
+
+	var (
+		filtered = make(map[string]int)
+		order    = make([]string, 0)
+	)
+
+	walk = func(u sitemap.URL) error {
+		loc, rule := f.match(u.Loc)
+		if rule != "" {
+			if _, ok := filtered[rule]; !ok {
+				order = append(order, rule)
+			}
+
+			filtered[rule]++
+
+			return nil
+		}
+
+		u.Loc = loc
+
+		return fn(u)
+	}
+
+	counts = func() []Count {
+		result := make([]Count, 0, len(order))
+
+		for _, rule := range order {
+			result = append(result, Count{
+				Rule:     rule,
+				Filtered: filtered[rule],
+			})
+		}
+
+		return result
+	}
+
+	return walk, counts
+}
+
+// match returns the URL to keep, or the name of the rule that filtered it out.
+func (f *Filter) match(raw string) (uri, rule string) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", RuleInvalid
+	}
+
+	if len(f.hosts) > 0 {
+		if _, ok := f.hosts[strings.ToLower(parsed.Hostname())]; !ok {
+			return "", RuleHost
+		}
+	}
+
+	path := parsed.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	if len(f.include) > 0 && !matchAny(f.include, path) {
+		return "", RuleNotInclude
+	}
+
+	for _, p := range f.exclude {
+		if p.Match(path) {
+			return "", p.String()
+		}
+	}
+
+	if f.stripQuery && (parsed.RawQuery != "" || parsed.ForceQuery) {
+		parsed.RawQuery = ""
+		parsed.ForceQuery = false
+
+		return parsed.String(), ""
+	}
+
+	return raw, ""
+}
+
+// matchAny reports whether the path matches any of the patterns.
+func matchAny(patterns []*Pattern, path string) bool {
+	for _, p := range patterns {
+		if p.Match(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globToRegexp converts a glob into an anchored regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+
+				continue
+			}
+
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return b.String()
+}
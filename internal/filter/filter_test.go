@@ -0,0 +1,212 @@
+package filter_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/filter"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestParsePattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{
+			name:    "exact match",
+			pattern: "/about",
+			path:    "/about",
+			want:    true,
+		},
+		{
+			name:    "single star within segment",
+			pattern: "/blog/*",
+			path:    "/blog/hello-world",
+			want:    true,
+		},
+		{
+			name:    "single star across segments",
+			pattern: "/blog/*",
+			path:    "/blog/2023/hello-world",
+			want:    false,
+		},
+		{
+			name:    "double star across segments",
+			pattern: "/blog/**",
+			path:    "/blog/2023/hello-world",
+			want:    true,
+		},
+		{
+			name:    "question mark",
+			pattern: "/page/?",
+			path:    "/page/2",
+			want:    true,
+		},
+		{
+			name:    "glob is anchored",
+			pattern: "/tag/*",
+			path:    "/blog/tag/go",
+			want:    false,
+		},
+		{
+			name:    "glob escapes metacharacters",
+			pattern: "/feed.xml",
+			path:    "/feedxxml",
+			want:    false,
+		},
+		{
+			name:    "regex is unanchored",
+			pattern: "re:/tag/",
+			path:    "/blog/tag/go",
+			want:    true,
+		},
+		{
+			name:    "anchored regex",
+			pattern: `re:^/\d{4}/`,
+			path:    "/blog/2023/",
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := filter.ParsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParsePattern() error = %v", err)
+			}
+
+			if got := p.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	_, err := filter.New(nil, []string{"re:("}, nil, false)
+	if !errors.Is(err, filter.ErrInvalidPattern) {
+		t.Errorf("New() error = %v, want %v", err, filter.ErrInvalidPattern)
+	}
+}
+
+func TestFilter_Apply(t *testing.T) {
+	t.Parallel()
+
+	locs := []string{
+		"https://example.com/",
+		"https://example.com/blog/hello-world?utm_source=feed",
+		"https://example.com/blog/second-post",
+		"https://example.com/tag/go",
+		"https://example.com/tag/rust",
+		"https://example.com/legal/privacy",
+		"https://cdn.example.com/blog/third-post",
+	}
+
+	urls := make([]sitemap.URL, 0, len(locs))
+
+	for _, loc := range locs {
+		urls = append(urls, sitemap.URL{Loc: loc, Priority: sitemap.DefaultPriority})
+	}
+
+	tests := []struct {
+		name       string
+		include    []string
+		exclude    []string
+		hosts      []string
+		stripQuery bool
+		want       []string
+		wantCounts []filter.Count
+	}{
+		{
+			name: "no rules",
+			want: locs,
+		},
+		{
+			name:    "include and exclude",
+			include: []string{"/blog/*", "/tag/*"},
+			exclude: []string{"/tag/go"},
+			want: []string{
+				"https://example.com/blog/hello-world?utm_source=feed",
+				"https://example.com/blog/second-post",
+				"https://example.com/tag/rust",
+				"https://cdn.example.com/blog/third-post",
+			},
+			wantCounts: []filter.Count{
+				{Rule: filter.RuleNotInclude, Filtered: 2},
+				{Rule: "/tag/go", Filtered: 1},
+			},
+		},
+		{
+			name:       "hosts and query stripping",
+			exclude:    []string{"re:^/(tag|legal)/"},
+			hosts:      []string{"Example.com"},
+			stripQuery: true,
+			want: []string{
+				"https://example.com/",
+				"https://example.com/blog/hello-world",
+				"https://example.com/blog/second-post",
+			},
+			wantCounts: []filter.Count{
+				{Rule: "re:^/(tag|legal)/", Filtered: 3},
+				{Rule: filter.RuleHost, Filtered: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := filter.New(tt.include, tt.exclude, tt.hosts, tt.stripQuery)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			got, counts := f.Apply(urls)
+
+			if locs := sitemap.Locs(got); !reflect.DeepEqual(locs, tt.want) {
+				t.Errorf("Apply() got = %v, want %v", locs, tt.want)
+			}
+
+			if !reflect.DeepEqual(counts, tt.wantCounts) {
+				t.Errorf("Apply() counts = %v, want %v", counts, tt.wantCounts)
+			}
+
+			walked := make([]string, 0, len(tt.want))
+
+			walk, walkCounts := f.Walk(func(u sitemap.URL) error {
+				walked = append(walked, u.Loc)
+
+				return nil
+			})
+
+			for _, u := range urls {
+				if err := walk(u); err != nil {
+					t.Fatalf("Walk() error = %v", err)
+				}
+			}
+
+			if !reflect.DeepEqual(walked, tt.want) {
+				t.Errorf("Walk() got = %v, want %v", walked, tt.want)
+			}
+
+			if got := walkCounts(); !reflect.DeepEqual(got, tt.wantCounts) {
+				t.Errorf("Walk() counts = %v, want %v", got, tt.wantCounts)
+			}
+		})
+	}
+}
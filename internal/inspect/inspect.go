@@ -0,0 +1,380 @@
+// Package inspect checks sitemaps for problems, such as invalid URLs or
+// documents that exceed the limits of the sitemaps protocol.
+package inspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/normalize"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// Limits of a single sitemap document, as defined by the sitemaps protocol.
+const (
+	// MaxURLs is the maximum number of URLs in a sitemap, or of sitemaps in a
+	// sitemap index.
+	MaxURLs = 50000
+
+	// MaxSize is the maximum uncompressed size of a sitemap, in bytes.
+	MaxSize = sitemap.DefaultMaxSize
+)
+
+// Kinds of issues found in sitemaps.
+const (
+	// KindFetch is the kind of issues caused by a sitemap that couldn't be
+	// downloaded.
+	KindFetch = "fetch"
+
+	// KindParse is the kind of issues caused by a sitemap that couldn't be
+	// parsed.
+	KindParse = "parse"
+
+	// KindProtocol is the kind of issues caused by a part of a sitemap that
+	// doesn't follow the sitemaps protocol, found by strict parsers.
+	KindProtocol = "protocol"
+
+	// KindTooManyURLs is the kind of issues caused by a sitemap listing more
+	// than MaxURLs URLs or sitemaps.
+	KindTooManyURLs = "too-many-urls"
+
+	// KindTooLarge is the kind of issues caused by a sitemap larger than
+	// MaxSize once uncompressed.
+	KindTooLarge = "too-large"
+
+	// KindMaxDepth is the kind of issues caused by sitemap indexes nested
+	// deeper than allowed.
+	KindMaxDepth = "max-depth"
+
+	// KindInvalid is the kind of issues caused by a location that isn't a
+	// valid HTTP or HTTPS URL.
+	KindInvalid = "invalid"
+
+	// KindRelative is the kind of issues caused by a relative location.
+	KindRelative = "relative"
+
+	// KindCrossHost is the kind of issues caused by a location on a different
+	// host than the sitemap listing it.
+	KindCrossHost = "cross-host"
+
+	// KindDuplicate is the kind of issues caused by a URL listed more than
+	// once.
+	KindDuplicate = "duplicate"
+)
+
+// Issue is a problem found in a sitemap.
+type Issue struct {
+	// Kind is the kind of the issue, such as KindDuplicate.
+	Kind string `json:"kind"`
+
+	// Sitemap is the URL of the sitemap the issue was found in.
+	Sitemap string `json:"sitemap"`
+
+	// URL is the location the issue is about, if any.
+	URL string `json:"url,omitempty"`
+
+	// Message describes the issue.
+	Message string `json:"message"`
+}
+
+// Document describes a single sitemap or sitemap index.
+type Document struct {
+	// URL is the URL of the sitemap.
+	URL string `json:"url"`
+
+	// Size is the uncompressed size of the sitemap, in bytes.
+	Size int64 `json:"size"`
+
+	// URLs is the number of URLs listed in a sitemap.
+	URLs int `json:"urls"`
+
+	// Sitemaps is the number of sitemaps listed in a sitemap index.
+	Sitemaps int `json:"sitemaps,omitempty"`
+
+	// Index reports whether the document is a sitemap index.
+	Index bool `json:"index"`
+}
+
+// Report is the result of inspecting a sitemap and the sitemaps it links to.
+type Report struct {
+	// URL is the URL of the inspected sitemap.
+	URL string `json:"url"`
+
+	// Documents describes every sitemap that could be downloaded and parsed.
+	Documents []Document `json:"documents"`
+
+	// Issues lists every problem found.
+	Issues []Issue `json:"issues"`
+
+	// URLs is the total number of URLs listed.
+	URLs int `json:"urls"`
+
+	// Unique is the number of distinct URLs listed.
+	Unique int `json:"unique"`
+}
+
+// OK reports whether no issues were found.
+func (r *Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Inspector downloads sitemaps and checks them for problems.
+type Inspector struct {
+	// fetchClient is the client used to download sitemaps.
+	fetchClient *fetch.Client
+
+	// parser is the Parser used to parse every downloaded document.
+	parser sitemap.Parser
+
+	// normalizer canonicalizes URLs before looking for duplicates. A nil
+	// normalizer applies the default rules.
+	normalizer *normalize.Normalizer
+
+	// maxDepth is the maximum number of nested sitemap indexes to follow.
+	maxDepth int
+}
+
+// New returns a new Inspector that parses documents with parser, follows up to
+// maxDepth nested sitemap indexes and finds duplicate URLs once normalized by
+// normalizer, like the server would. If parser is nil, sitemap.AutoParser is
+// used, and if maxDepth is less than one, sitemap.DefaultMaxDepth is used.
+func New(fetchClient *fetch.Client, parser sitemap.Parser, normalizer *normalize.Normalizer, maxDepth int) *Inspector {
+	if parser == nil {
+		parser = sitemap.AutoParser{}
+	}
+
+	if maxDepth < 1 {
+		maxDepth = sitemap.DefaultMaxDepth
+	}
+
+	return &Inspector{
+		fetchClient: fetchClient,
+		parser:      parser,
+		normalizer:  normalizer,
+		maxDepth:    maxDepth,
+	}
+}
+
+// Inspect downloads the sitemap at uri, and every sitemap it links to if it's
+// a sitemap index, and returns a report of what was found. Problems, including
+// sitemaps that can't be downloaded or parsed, are reported as issues rather
+// than errors.
+func (i *Inspector) Inspect(ctx context.Context, uri string) *Report {
+	var (
+		report = &Report{
+			URL:       uri,
+			Documents: make([]Document, 0),
+			Issues:    make([]Issue, 0),
+		}
+		resolver = sitemap.NewResolver(i.fetchClient, i.parser, i.maxDepth)
+		seen     = make(map[string]int)
+		order    = make([]string, 0, sitemap.AverageSitemapSize)
+		sources  = make(map[string]string)
+	)
+
+	record := func(sitemapURL, loc string) {
+		if _, ok := seen[loc]; !ok {
+			order = append(order, loc)
+			sources[loc] = sitemapURL
+		}
+
+		seen[loc]++
+	}
+
+	// Every problem is reported as an issue, so accept every document the
+	// resolver visits, and let it follow the children of every sitemap index
+	// it could read. It then only fails if ctx is canceled.
+	_, err := resolver.Resolve(ctx, uri, func(v *sitemap.Visit) error {
+		i.visit(v, report, record)
+
+		return nil
+	})
+	if err != nil {
+		report.Issues = append(report.Issues, Issue{
+			Kind:    KindFetch,
+			Sitemap: uri,
+			Message: err.Error(),
+		})
+	}
+
+	report.Unique = len(seen)
+
+	for _, loc := range order {
+		if count := seen[loc]; count > 1 {
+			report.Issues = append(report.Issues, Issue{
+				Kind:    KindDuplicate,
+				Sitemap: sources[loc],
+				URL:     loc,
+				Message: fmt.Sprintf("listed %d times", count),
+			})
+		}
+	}
+
+	return report
+}
+
+// visit checks a single sitemap visited by the resolver. Every URL listed is
+// passed to record, normalized if possible.
+func (i *Inspector) visit(v *sitemap.Visit, report *Report, record func(sitemapURL, loc string)) {
+	if v.Parent != "" {
+		issue, ok := checkLocation(v.Parent, v.URL)
+		if !ok {
+			report.Issues = append(report.Issues, issue)
+
+			// A sitemap at an invalid or relative location can't be
+			// downloaded, which is already reported.
+			if issue.Kind != KindCrossHost && v.Document == nil {
+				return
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(v.Err, sitemap.ErrMaxDepth):
+		report.Issues = append(report.Issues, Issue{
+			Kind:    KindMaxDepth,
+			Sitemap: v.URL,
+			Message: fmt.Sprintf("sitemap indexes nested more than %d levels deep aren't followed", i.maxDepth),
+		})
+	case v.Err != nil:
+		report.Issues = append(report.Issues, fetchIssues(v.URL, v.Err)...)
+	}
+
+	doc := v.Document
+	if doc == nil {
+		return
+	}
+
+	entry := Document{
+		URL:   v.URL,
+		Size:  doc.Size(),
+		Index: doc.IsIndex(),
+	}
+
+	listed := len(doc.URLs)
+	if doc.IsIndex() {
+		listed = len(doc.Sitemaps)
+		entry.Sitemaps = listed
+	} else {
+		entry.URLs = listed
+	}
+
+	report.Documents = append(report.Documents, entry)
+
+	if listed > MaxURLs {
+		report.Issues = append(report.Issues, Issue{
+			Kind:    KindTooManyURLs,
+			Sitemap: v.URL,
+			Message: fmt.Sprintf("lists %d entries, more than the maximum of %d", listed, MaxURLs),
+		})
+	}
+
+	if doc.IsIndex() {
+		return
+	}
+
+	for _, u := range doc.URLs {
+		report.URLs++
+
+		if issue, ok := checkLocation(v.URL, u.Loc); !ok {
+			report.Issues = append(report.Issues, issue)
+		}
+
+		loc := u.Loc
+		if normalized, err := i.normalizer.Normalize(loc); err == nil {
+			loc = i.normalizer.Key(normalized)
+		}
+
+		record(v.URL, loc)
+	}
+}
+
+// fetchIssues returns the issues describing why the sitemap at uri couldn't
+// be downloaded or parsed. Every protocol violation found by a strict parser is
+// reported as its own issue.
+func fetchIssues(uri string, err error) []Issue {
+	var validationErr *sitemap.ValidationError
+
+	if errors.As(err, &validationErr) {
+		issues := make([]Issue, 0, len(validationErr.Violations)+1)
+
+		for _, violation := range validationErr.Violations {
+			issues = append(issues, Issue{
+				Kind:    KindProtocol,
+				Sitemap: uri,
+				Message: violation.String(),
+			})
+		}
+
+		if validationErr.Omitted > 0 {
+			issues = append(issues, Issue{
+				Kind:    KindProtocol,
+				Sitemap: uri,
+				Message: fmt.Sprintf("%d more violations not listed", validationErr.Omitted),
+			})
+		}
+
+		return issues
+	}
+
+	issue := Issue{
+		Kind:    KindParse,
+		Sitemap: uri,
+		Message: err.Error(),
+	}
+
+	switch {
+	case errors.Is(err, sitemap.ErrTooLarge):
+		issue.Kind = KindTooLarge
+		issue.Message = fmt.Sprintf("larger than the maximum of %d bytes once uncompressed", MaxSize)
+	case errors.Is(err, fetch.ErrFetchData):
+		issue.Kind = KindFetch
+	}
+
+	return []Issue{issue}
+}
+
+// checkLocation checks a location listed in the sitemap at sitemapURL. If the
+// location has a problem, the issue describing it and false are returned.
+func checkLocation(sitemapURL, loc string) (Issue, bool) {
+	issue := Issue{
+		Sitemap: sitemapURL,
+		URL:     loc,
+	}
+
+	parsed, err := url.Parse(loc)
+	if err != nil {
+		issue.Kind = KindInvalid
+		issue.Message = "not a valid URL"
+
+		return issue, false
+	}
+
+	if !parsed.IsAbs() || parsed.Host == "" {
+		issue.Kind = KindRelative
+		issue.Message = "not an absolute URL"
+
+		return issue, false
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		issue.Kind = KindInvalid
+		issue.Message = fmt.Sprintf("unsupported scheme %q", parsed.Scheme)
+
+		return issue, false
+	}
+
+	base, err := url.Parse(sitemapURL)
+	if err == nil && !strings.EqualFold(base.Hostname(), parsed.Hostname()) {
+		issue.Kind = KindCrossHost
+		issue.Message = fmt.Sprintf("not on the sitemap's host %q", base.Hostname())
+
+		return issue, false
+	}
+
+	return Issue{}, true
+}
@@ -0,0 +1,292 @@
+package inspect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/inspect"
+	"git.sr.ht/~jamesponddotco/sitred/internal/normalize"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// testRateLimit is high enough for tests downloading several sitemaps not to
+// wait on the rate limit of the client.
+const testRateLimit = 1000
+
+func TestInspector_Inspect(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + srv.URL + `/posts.xml</loc></sitemap>
+  <sitemap><loc>` + srv.URL + `/broken.xml</loc></sitemap>
+  <sitemap><loc>` + srv.URL + `/missing.xml</loc></sitemap>
+  <sitemap><loc>/relative.xml</loc></sitemap>
+</sitemapindex>`))
+		case "/posts.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + srv.URL + `/a</loc></url>
+  <url><loc>` + srv.URL + `/b</loc></url>
+  <url><loc>` + srv.URL + `/a</loc></url>
+  <url><loc>/c</loc></url>
+  <url><loc>ftp://` + r.Host + `/d</loc></url>
+  <url><loc>https://other.example.com/e</loc></url>
+</urlset>`))
+		case "/broken.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + srv.URL + `/f</loc>
+</urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		inspector = inspect.New(fetch.New("TestService", "test@example.com", testRateLimit), nil, nil, 0)
+		report    = inspector.Inspect(context.Background(), srv.URL+"/index.xml")
+	)
+
+	if report.OK() {
+		t.Fatal("Inspect() OK() = true, want issues")
+	}
+
+	if report.URLs != 6 || report.Unique != 5 {
+		t.Errorf("Inspect() URLs = %d, Unique = %d, want 6 and 5", report.URLs, report.Unique)
+	}
+
+	if len(report.Documents) != 2 {
+		t.Errorf("Inspect() got %d documents, want 2", len(report.Documents))
+	}
+
+	wantKinds := map[string]string{
+		inspect.KindDuplicate: srv.URL + "/a",
+		inspect.KindRelative:  "/c",
+		inspect.KindInvalid:   "/d",
+		inspect.KindCrossHost: "https://other.example.com/e",
+		inspect.KindParse:     srv.URL + "/broken.xml",
+		inspect.KindFetch:     srv.URL + "/missing.xml",
+	}
+
+	for kind, subject := range wantKinds {
+		found := false
+
+		for _, issue := range report.Issues {
+			if issue.Kind != kind {
+				continue
+			}
+
+			if strings.HasSuffix(issue.URL, subject) || issue.Sitemap == subject {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("Inspect() missing %s issue for %q in %+v", kind, subject, report.Issues)
+		}
+	}
+}
+
+func TestInspector_InspectLimits(t *testing.T) {
+	t.Parallel()
+
+	var body strings.Builder
+
+	body.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body.String()))
+	}))
+	t.Cleanup(srv.Close)
+
+	for i := 0; i <= inspect.MaxURLs; i++ {
+		body.WriteString("<url><loc>" + srv.URL + "/</loc></url>\n")
+	}
+
+	body.WriteString("</urlset>")
+
+	var (
+		inspector = inspect.New(fetch.New("TestService", "test@example.com", testRateLimit), nil, nil, 0)
+		report    = inspector.Inspect(context.Background(), srv.URL)
+	)
+
+	var tooMany bool
+
+	for _, issue := range report.Issues {
+		if issue.Kind == inspect.KindTooManyURLs {
+			tooMany = true
+		}
+	}
+
+	if !tooMany {
+		t.Errorf("Inspect() missing %s issue in %+v", inspect.KindTooManyURLs, report.Issues)
+	}
+}
+
+func TestInspector_InspectStrict(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset>
+  <url><loc>http://` + r.Host + `/a</loc><priority>high</priority></url>
+</urlset>`))
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		inspector = inspect.New(fetch.New("TestService", "test@example.com", testRateLimit), sitemap.XMLParser{Strict: true}, nil, 0)
+		report    = inspector.Inspect(context.Background(), srv.URL)
+	)
+
+	want := []string{
+		`line 2: <urlset> is missing the "http://www.sitemaps.org/schemas/sitemap/0.9" namespace`,
+		`line 3: <priority> "high" isn't a number between 0.0 and 1.0`,
+	}
+
+	if len(report.Issues) != len(want) {
+		t.Fatalf("Inspect() got %d issues, want %d: %+v", len(report.Issues), len(want), report.Issues)
+	}
+
+	for i, issue := range report.Issues {
+		if issue.Kind != inspect.KindProtocol || issue.Message != want[i] {
+			t.Errorf("Inspect() issue %d = %+v, want %s issue %q", i, issue, inspect.KindProtocol, want[i])
+		}
+	}
+}
+
+func TestInspector_InspectStrictIndex(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + srv.URL + `/posts.xml</loc><lastmod>yesterday</lastmod></sitemap>
+</sitemapindex>`))
+		case "/posts.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + srv.URL + `/a</loc></url>
+  <url><loc>` + srv.URL + `/b</loc></url>
+</urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		inspector = inspect.New(fetch.New("TestService", "test@example.com", testRateLimit), sitemap.XMLParser{Strict: true}, nil, 0)
+		report    = inspector.Inspect(context.Background(), srv.URL+"/index.xml")
+	)
+
+	if len(report.Issues) != 1 || report.Issues[0].Kind != inspect.KindProtocol {
+		t.Fatalf("Inspect() got issues %+v, want a single %s issue", report.Issues, inspect.KindProtocol)
+	}
+
+	if len(report.Documents) != 2 {
+		t.Fatalf("Inspect() got %d documents, want 2", len(report.Documents))
+	}
+
+	if report.Documents[0].Sitemaps != 1 || report.Documents[1].URLs != 2 {
+		t.Errorf("Inspect() got documents %+v, want the index and its child", report.Documents)
+	}
+
+	if report.URLs != 2 || report.Unique != 2 {
+		t.Errorf("Inspect() URLs = %d, Unique = %d, want 2 and 2", report.URLs, report.Unique)
+	}
+}
+
+func TestInspector_InspectNormalize(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://` + r.Host + `/a</loc></url>
+  <url><loc>http://` + r.Host + `/a/?utm_source=feed</loc></url>
+  <url><loc>HTTP://` + r.Host + `/b#top</loc></url>
+  <url><loc>http://` + r.Host + `/b</loc></url>
+</urlset>`))
+	}))
+	t.Cleanup(srv.Close)
+
+	normalizer, err := normalize.New([]string{"utm_*"}, false, true)
+	if err != nil {
+		t.Fatalf("normalize.New() error = %v", err)
+	}
+
+	var (
+		inspector = inspect.New(fetch.New("TestService", "test@example.com", testRateLimit), nil, normalizer, 0)
+		report    = inspector.Inspect(context.Background(), srv.URL)
+	)
+
+	if report.URLs != 4 || report.Unique != 2 {
+		t.Errorf("Inspect() URLs = %d, Unique = %d, want 4 and 2", report.URLs, report.Unique)
+	}
+
+	var duplicates int
+
+	for _, issue := range report.Issues {
+		if issue.Kind == inspect.KindDuplicate {
+			duplicates++
+		}
+	}
+
+	if duplicates != 2 {
+		t.Errorf("Inspect() got %d %s issues, want 2: %+v", duplicates, inspect.KindDuplicate, report.Issues)
+	}
+}
+
+func TestInspector_InspectMaxDepth(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + srv.URL + `/nested.xml</loc></sitemap>
+</sitemapindex>`))
+		case "/nested.xml":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + srv.URL + `/posts.xml</loc></sitemap>
+</sitemapindex>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		inspector = inspect.New(fetch.New("TestService", "test@example.com", testRateLimit), nil, nil, 1)
+		report    = inspector.Inspect(context.Background(), srv.URL+"/index.xml")
+	)
+
+	if len(report.Issues) != 1 || report.Issues[0].Kind != inspect.KindMaxDepth || report.Issues[0].Sitemap != srv.URL+"/nested.xml" {
+		t.Fatalf("Inspect() got issues %+v, want a single %s issue", report.Issues, inspect.KindMaxDepth)
+	}
+
+	if len(report.Documents) != 2 || report.Documents[1].Size == 0 {
+		t.Errorf("Inspect() got documents %+v, want both indexes with their size", report.Documents)
+	}
+}
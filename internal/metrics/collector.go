@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// labelSeparator separates label values in the key of a series. It can't
+// appear in valid UTF-8 text, so label values never collide.
+const labelSeparator = "\xff"
+
+// labelEscaper escapes label values for the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`) //nolint:gochecknoglobals // Read-only and safe for concurrent use.
+
+// series is a single time series of a metric family, identified by its label
+// values.
+type series struct {
+	// values are the label values of the series, in the order of the family's
+	// label names.
+	values []string
+
+	// buckets are the cumulative bucket counts of a histogram series.
+	buckets []uint64
+
+	// value is the value of a counter or gauge, or the sum of a histogram.
+	value float64
+
+	// count is the number of observations of a histogram series.
+	count uint64
+}
+
+// family is a named metric with a fixed set of label names and any number of
+// series.
+type family struct {
+	series map[string]*series
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	// bounds are the upper bounds of a histogram's buckets, in increasing
+	// order.
+	bounds []float64
+
+	mu sync.Mutex
+}
+
+// newFamily returns a new metric family.
+func newFamily(name, help, kind string, bounds []float64, labels ...string) *family {
+	return &family{
+		series: make(map[string]*series),
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		bounds: bounds,
+	}
+}
+
+// get returns the series for the given label values, creating it if needed.
+// The caller must hold mu.
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, labelSeparator)
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{
+			values:  values,
+			buckets: make([]uint64, len(f.bounds)),
+		}
+
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// add adds delta to the series with the given label values.
+func (f *family) add(delta float64, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.get(values).value += delta
+}
+
+// set sets the series with the given label values to value.
+func (f *family) set(value float64, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.get(values).value = value
+}
+
+// observe records an observation in the histogram series with the given label
+// values.
+func (f *family) observe(value float64, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(values)
+
+	for i, bound := range f.bounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+
+	s.value += value
+	s.count++
+}
+
+// reset removes every series of the family.
+func (f *family) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.series = make(map[string]*series)
+}
+
+// write writes the family in the Prometheus text exposition format.
+func (f *family) write(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+
+		if f.kind != kindHistogram {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.values, ""), formatFloat(s.value)); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+
+			continue
+		}
+
+		for i, bound := range f.bounds {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.values, formatFloat(bound)), s.buckets[i]); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+
+		_, err := fmt.Fprintf(
+			w,
+			"%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			f.name, f.labelString(s.values, "+Inf"), s.count,
+			f.name, f.labelString(s.values, ""), formatFloat(s.value),
+			f.name, f.labelString(s.values, ""), s.count,
+		)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	return nil
+}
+
+// labelString returns the label set of a series in the text exposition
+// format. If le isn't empty, it's added as the bucket's upper bound.
+func (f *family) labelString(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(values)+1)
+
+	for i, value := range values {
+		pairs = append(pairs, f.labels[i]+`="`+labelEscaper.Replace(value)+`"`)
+	}
+
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat formats a sample value as expected by Prometheus.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
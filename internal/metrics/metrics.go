@@ -0,0 +1,305 @@
+// Package metrics collects metrics about the service and exposes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric kinds, as reported in the TYPE line of a metric family.
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// Reasons for error responses, used as the reason label of the errors metric.
+const (
+	// ReasonFetch is the reason of errors caused by a sitemap that couldn't
+	// be downloaded.
+	ReasonFetch = "fetch"
+
+	// ReasonParse is the reason of errors caused by a sitemap that couldn't
+	// be parsed.
+	ReasonParse = "parse"
+
+	// ReasonEmpty is the reason of errors caused by a sitemap without URLs.
+	ReasonEmpty = "empty"
+)
+
+// Outcomes of sitemap fetches, used as the outcome label of the fetch
+// duration metric.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Metrics holds every metric collected by the service. A nil *Metrics is valid
+// and discards everything, so metrics can be disabled by not creating one.
+type Metrics struct {
+	buildInfo     *family
+	redirects     *family
+	errors        *family
+	fetchDuration *family
+	urls          *family
+	cacheHits     *family
+	cacheMisses   *family
+	httpDuration  *family
+	families      []*family
+}
+
+// New returns a new Metrics instance.
+func New() *Metrics {
+	m := &Metrics{
+		buildInfo: newFamily(
+			"sitred_build_info",
+			"Version of the service.",
+			kindGauge,
+			nil,
+			"version",
+		),
+		redirects: newFamily(
+			"sitred_redirects_total",
+			"Number of redirects served.",
+			kindCounter,
+			nil,
+			"sitemap", "endpoint",
+		),
+		errors: newFamily(
+			"sitred_errors_total",
+			"Number of error responses served because no URL could be chosen.",
+			kindCounter,
+			nil,
+			"sitemap", "reason",
+		),
+		fetchDuration: newFamily(
+			"sitred_sitemap_fetch_duration_seconds",
+			"Time spent downloading and parsing sitemaps.",
+			kindHistogram,
+			[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+			"sitemap", "outcome",
+		),
+		urls: newFamily(
+			"sitred_sitemap_urls",
+			"Number of URLs in the cached sitemap.",
+			kindGauge,
+			nil,
+			"sitemap",
+		),
+		cacheHits: newFamily(
+			"sitred_cache_hits_total",
+			"Number of requests served from the sitemap cache.",
+			kindCounter,
+			nil,
+			"sitemap",
+		),
+		cacheMisses: newFamily(
+			"sitred_cache_misses_total",
+			"Number of requests that had to wait for the sitemap to be loaded.",
+			kindCounter,
+			nil,
+			"sitemap",
+		),
+		httpDuration: newFamily(
+			"sitred_http_request_duration_seconds",
+			"Time spent serving HTTP requests.",
+			kindHistogram,
+			[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			"method", "code",
+		),
+	}
+
+	m.families = []*family{
+		m.buildInfo,
+		m.redirects,
+		m.errors,
+		m.fetchDuration,
+		m.urls,
+		m.cacheHits,
+		m.cacheMisses,
+		m.httpDuration,
+	}
+
+	m.buildInfo.set(1, sitred.Version)
+
+	return m
+}
+
+// Redirect records a redirect to a URL from the given sitemap, served by the
+// given endpoint.
+func (m *Metrics) Redirect(sitemapURL, endpoint string) {
+	if m == nil {
+		return
+	}
+
+	m.redirects.add(1, sitemapURL, endpoint)
+}
+
+// Error records an error response for the given sitemap. The reason should be
+// one of ReasonFetch, ReasonParse, or ReasonEmpty.
+func (m *Metrics) Error(sitemapURL, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.errors.add(1, sitemapURL, reason)
+}
+
+// Fetch records how long it took to download and parse the given sitemap, and
+// whether it succeeded.
+func (m *Metrics) Fetch(sitemapURL string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+
+	m.fetchDuration.observe(duration.Seconds(), sitemapURL, outcome)
+}
+
+// URLs records the number of URLs in the given sitemap.
+func (m *Metrics) URLs(sitemapURL string, count int) {
+	if m == nil {
+		return
+	}
+
+	m.urls.set(float64(count), sitemapURL)
+}
+
+// ResetURLs forgets the number of URLs of every sitemap, so sitemaps that are
+// no longer served after a reload stop being reported.
+func (m *Metrics) ResetURLs() {
+	if m == nil {
+		return
+	}
+
+	m.urls.reset()
+}
+
+// CacheHit records a request for the given sitemap served from the cache.
+func (m *Metrics) CacheHit(sitemapURL string) {
+	if m == nil {
+		return
+	}
+
+	m.cacheHits.add(1, sitemapURL)
+}
+
+// CacheMiss records a request for the given sitemap that had to wait for the
+// sitemap to be loaded.
+func (m *Metrics) CacheMiss(sitemapURL string) {
+	if m == nil {
+		return
+	}
+
+	m.cacheMisses.add(1, sitemapURL)
+}
+
+// Middleware records the duration of every HTTP request served by h.
+func (m *Metrics) Middleware(h http.Handler) http.Handler {
+	if m == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			start    = time.Now()
+			recorder = &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		)
+
+		h.ServeHTTP(recorder, r)
+
+		m.httpDuration.observe(time.Since(start).Seconds(), r.Method, strconv.Itoa(recorder.code))
+	})
+}
+
+// Handler returns an HTTP handler serving the metrics in the Prometheus text
+// exposition format.
+func (m *Metrics) Handler(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m == nil {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		var buf bytes.Buffer
+
+		for _, f := range m.families {
+			if err := f.write(&buf); err != nil {
+				logger.LogAttrs(
+					r.Context(),
+					slog.LevelError,
+					"failed to write metrics",
+					slog.String("error", err.Error()),
+				)
+
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+				return
+			}
+		}
+
+		w.Header().Set(xhttp.ContentType, ContentType)
+		w.Header().Set(xhttp.CacheControl, "no-store")
+
+		if _, err := buf.WriteTo(w); err != nil {
+			logger.LogAttrs(
+				r.Context(),
+				slog.LevelError,
+				"failed to send metrics",
+				slog.String("error", err.Error()),
+			)
+		}
+	})
+}
+
+// statusRecorder is an http.ResponseWriter that remembers the status code of
+// the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+// WriteHeader records the status code and sends it to the client.
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.code = code
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write sends the response body to the client.
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+
+	n, err := r.ResponseWriter.Write(b)
+	if err != nil {
+		return n, fmt.Errorf("%w", err)
+	}
+
+	return n, nil
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by
+// http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,116 @@
+package metrics_test
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+)
+
+// scrape returns the metrics served by m's handler.
+func scrape(t *testing.T, m *metrics.Metrics) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		w      = httptest.NewRecorder()
+	)
+
+	m.Handler(logger).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+	return w
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+
+	m.Redirect("https://example.com/sitemap.xml", "random")
+	m.Redirect("https://example.com/sitemap.xml", "random")
+	m.Error("https://example.com/sitemap.xml", metrics.ReasonEmpty)
+	m.Fetch("https://example.com/sitemap.xml", 300*time.Millisecond, nil)
+	m.Fetch("https://example.com/sitemap.xml", time.Second, errors.New("boom"))
+	m.URLs("https://example.com/sitemap.xml", 42)
+	m.CacheHit("https://example.com/sitemap.xml")
+	m.CacheMiss("https://example.com/sitemap.xml")
+	m.URLs("https://example.com/\"quoted\"\n", 1)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	w := scrape(t, m)
+
+	if got := w.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("Handler() Content-Type = %q, want %q", got, metrics.ContentType)
+	}
+
+	body := w.Body.String()
+
+	tests := []string{
+		"# TYPE sitred_redirects_total counter",
+		`sitred_build_info{version="` + sitred.Version + `"} 1`,
+		`sitred_redirects_total{sitemap="https://example.com/sitemap.xml",endpoint="random"} 2`,
+		`sitred_errors_total{sitemap="https://example.com/sitemap.xml",reason="empty"} 1`,
+		`sitred_sitemap_fetch_duration_seconds_bucket{sitemap="https://example.com/sitemap.xml",outcome="success",le="0.25"} 0`,
+		`sitred_sitemap_fetch_duration_seconds_bucket{sitemap="https://example.com/sitemap.xml",outcome="success",le="0.5"} 1`,
+		`sitred_sitemap_fetch_duration_seconds_bucket{sitemap="https://example.com/sitemap.xml",outcome="success",le="+Inf"} 1`,
+		`sitred_sitemap_fetch_duration_seconds_sum{sitemap="https://example.com/sitemap.xml",outcome="failure"} 1`,
+		`sitred_sitemap_fetch_duration_seconds_count{sitemap="https://example.com/sitemap.xml",outcome="failure"} 1`,
+		`sitred_sitemap_urls{sitemap="https://example.com/sitemap.xml"} 42`,
+		`sitred_sitemap_urls{sitemap="https://example.com/\"quoted\"\n"} 1`,
+		`sitred_cache_hits_total{sitemap="https://example.com/sitemap.xml"} 1`,
+		`sitred_cache_misses_total{sitemap="https://example.com/sitemap.xml"} 1`,
+		`sitred_http_request_duration_seconds_count{method="GET",code="302"} 1`,
+	}
+
+	for _, want := range tests {
+		if !strings.Contains(body, want) {
+			t.Errorf("Handler() missing %q in:\n%s", want, body)
+		}
+	}
+
+	m.ResetURLs()
+
+	if body = scrape(t, m).Body.String(); strings.Contains(body, "sitred_sitemap_urls{") {
+		t.Errorf("Handler() after ResetURLs() still reports URL counts:\n%s", body)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	t.Parallel()
+
+	var m *metrics.Metrics
+
+	m.Redirect("https://example.com/sitemap.xml", "random")
+	m.Error("https://example.com/sitemap.xml", metrics.ReasonFetch)
+	m.Fetch("https://example.com/sitemap.xml", time.Second, nil)
+	m.URLs("https://example.com/sitemap.xml", 1)
+	m.ResetURLs()
+	m.CacheHit("https://example.com/sitemap.xml")
+	m.CacheMiss("https://example.com/sitemap.xml")
+
+	called := false
+
+	handler := m.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	if !called {
+		t.Error("Middleware() on nil Metrics didn't call the wrapped handler")
+	}
+
+	if w := scrape(t, m); w.Code != http.StatusNotFound {
+		t.Errorf("Handler() on nil Metrics status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,248 @@
+// Package normalize canonicalizes sitemap URLs so the same page isn't listed
+// more than once under different spellings.
+package normalize
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+const (
+	// ErrInvalidLocation is returned when a sitemap lists a location that
+	// isn't an absolute HTTP or HTTPS URL.
+	ErrInvalidLocation xerrors.Error = "sitemap location is invalid; must be an absolute HTTP or HTTPS URL"
+
+	// ErrInvalidParam is returned when a query parameter pattern is
+	// malformed.
+	ErrInvalidParam xerrors.Error = "invalid query parameter pattern"
+)
+
+// defaultPorts maps the schemes supported by sitemaps to their default port.
+var defaultPorts = map[string]string{ //nolint:gochecknoglobals // Maps cannot be constants.
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalizer canonicalizes sitemap URLs and removes duplicates.
+//
+// Every URL has its scheme and host lowercased, its default port and fragment
+// removed, and an empty path replaced by "/". A nil Normalizer applies only
+// those rules.
+type Normalizer struct {
+	params        []string
+	https         bool
+	trailingSlash bool
+}
+
+// New returns a new Normalizer.
+//
+// Query parameters whose name matches any of the params patterns are removed,
+// where patterns use the syntax of path.Match, such as "utm_*". If https is
+// true, HTTP URLs without an explicit port are rewritten to HTTPS. If
+// trailingSlash is true, URLs that only differ by a trailing slash are
+// considered duplicates, and the first one listed is kept.
+func New(params []string, https, trailingSlash bool) (*Normalizer, error) {
+	for _, pattern := range params {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidParam, pattern, err)
+		}
+	}
+
+	return &Normalizer{
+		params:        params,
+		https:         https,
+		trailingSlash: trailingSlash,
+	}, nil
+}
+
+// Normalize returns the canonical form of loc, or ErrInvalidLocation, wrapped
+// in sitemap.ErrSitemap, if it isn't an absolute HTTP or HTTPS URL.
+func (n *Normalizer) Normalize(loc string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(loc))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w: %q", sitemap.ErrSitemap, ErrInvalidLocation, loc)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+
+	defaultPort, ok := defaultPorts[parsed.Scheme]
+	if !ok || parsed.Host == "" {
+		return "", fmt.Errorf("%w: %w: %q", sitemap.ErrSitemap, ErrInvalidLocation, loc)
+	}
+
+	host := strings.ToLower(parsed.Host)
+
+	if port := parsed.Port(); port == defaultPort || port == "" {
+		host = strings.TrimSuffix(strings.TrimSuffix(host, ":"+port), ":")
+
+		if n != nil && n.https && parsed.Scheme == "http" {
+			parsed.Scheme = "https"
+		}
+	}
+
+	parsed.Host = host
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	parsed.ForceQuery = false
+
+	if parsed.Path == "" && parsed.Opaque == "" {
+		parsed.Path = "/"
+		parsed.RawPath = ""
+	}
+
+	if n != nil && len(n.params) > 0 {
+		parsed.RawQuery = n.stripParams(parsed.RawQuery)
+	}
+
+	return parsed.String(), nil
+}
+
+// stripParams removes the parameters matching any of the configured patterns
+// from a raw query string, keeping the order and encoding of the others.
+func (n *Normalizer) stripParams(query string) string {
+	if query == "" {
+		return ""
+	}
+
+	kept := make([]string, 0, strings.Count(query, "&")+1)
+
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(pair, "=")
+
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if !n.matchParam(name) {
+			kept = append(kept, pair)
+		}
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// matchParam reports whether a query parameter name matches any of the
+// configured patterns.
+func (n *Normalizer) matchParam(name string) bool {
+	for _, pattern := range n.params {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL returns u with its location and the location of its alternates
+// normalized. Alternates with an invalid location are dropped, but an invalid
+// location for u itself returns ErrInvalidLocation.
+func (n *Normalizer) URL(u sitemap.URL) (sitemap.URL, error) {
+	loc, err := n.Normalize(u.Loc)
+	if err != nil {
+		return sitemap.URL{}, err
+	}
+
+	u.Loc = loc
+
+	if len(u.Alternates) == 0 {
+		return u, nil
+	}
+
+	alternates := make([]sitemap.Alternate, 0, len(u.Alternates))
+
+	for _, alternate := range u.Alternates {
+		href, err := n.Normalize(alternate.Href)
+		if err != nil {
+			continue
+		}
+
+		alternate.Href = href
+		alternates = append(alternates, alternate)
+	}
+
+	u.Alternates = alternates
+
+	return u, nil
+}
+
+// Apply returns the URLs with their locations normalized, or
+// ErrInvalidLocation if any of them isn't an absolute HTTP or HTTPS URL.
+func (n *Normalizer) Apply(urls []sitemap.URL) ([]sitemap.URL, error) {
+	normalized := make([]sitemap.URL, 0, len(urls))
+
+	for _, u := range urls {
+		u, err := n.URL(u)
+		if err != nil {
+			return nil, err
+		}
+
+		normalized = append(normalized, u)
+	}
+
+	return normalized, nil
+}
+
+// Walk returns a sitemap.WalkFunc that calls fn for every URL with its
+// location normalized, for use when URLs are streamed rather than collected in
+// a slice. The walk stops with ErrInvalidLocation if a location isn't an
+// absolute HTTP or HTTPS URL.
+func (n *Normalizer) Walk(fn sitemap.WalkFunc) sitemap.WalkFunc {
+	return func(u sitemap.URL) error {
+		u, err := n.URL(u)
+		if err != nil {
+			return err
+		}
+
+		return fn(u)
+	}
+}
+
+// Dedupe returns the URLs without duplicates, keeping the first occurrence of
+// every location, along with the number of duplicates removed. Locations are
+// expected to be normalized already.
+func (n *Normalizer) Dedupe(urls []sitemap.URL) (unique []sitemap.URL, duplicates int) {
+	var (
+		seen = make(map[string]struct{}, len(urls))
+		kept = make([]sitemap.URL, 0, len(urls))
+	)
+
+	for _, u := range urls {
+		key := n.Key(u.Loc)
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		kept = append(kept, u)
+	}
+
+	return kept, len(urls) - len(kept)
+}
+
+// Key returns the key used to find duplicates of a normalized location, which
+// is the location itself unless trailing slashes are ignored.
+func (n *Normalizer) Key(loc string) string {
+	if n == nil || !n.trailingSlash {
+		return loc
+	}
+
+	parsed, err := url.Parse(loc)
+	if err != nil || parsed.Path == "/" {
+		return loc
+	}
+
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	parsed.RawPath = strings.TrimSuffix(parsed.RawPath, "/")
+
+	return parsed.String()
+}
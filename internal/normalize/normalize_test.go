@@ -0,0 +1,177 @@
+package normalize_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/normalize"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestNormalizer_Normalize(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := normalize.New([]string{"utm_*", "fbclid"}, true, false)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		normalizer *normalize.Normalizer
+		loc        string
+		want       string
+		wantErr    error
+	}{
+		{
+			name: "already normalized",
+			loc:  "https://example.com/page",
+			want: "https://example.com/page",
+		},
+		{
+			name: "scheme and host case",
+			loc:  "HTTPS://Example.COM/Page",
+			want: "https://example.com/Page",
+		},
+		{
+			name: "default port",
+			loc:  "http://example.com:80/page",
+			want: "http://example.com/page",
+		},
+		{
+			name: "other port",
+			loc:  "https://example.com:8443/page",
+			want: "https://example.com:8443/page",
+		},
+		{
+			name: "fragment and empty path",
+			loc:  "https://example.com#top",
+			want: "https://example.com/",
+		},
+		{
+			name: "surrounding whitespace",
+			loc:  "  https://example.com/page\n",
+			want: "https://example.com/page",
+		},
+		{
+			name:       "query parameters",
+			normalizer: normalizer,
+			loc:        "https://example.com/page?id=1&utm_source=feed&fbclid=abc&q=a%20b",
+			want:       "https://example.com/page?id=1&q=a%20b",
+		},
+		{
+			name:       "only stripped query parameters",
+			normalizer: normalizer,
+			loc:        "https://example.com/page?utm_medium=email",
+			want:       "https://example.com/page",
+		},
+		{
+			name:       "https upgrade",
+			normalizer: normalizer,
+			loc:        "http://example.com:80/page",
+			want:       "https://example.com/page",
+		},
+		{
+			name:       "no https upgrade with explicit port",
+			normalizer: normalizer,
+			loc:        "http://example.com:8080/page",
+			want:       "http://example.com:8080/page",
+		},
+		{
+			name:    "relative location",
+			loc:     "/page",
+			wantErr: normalize.ErrInvalidLocation,
+		},
+		{
+			name:    "unsupported scheme",
+			loc:     "ftp://example.com/file",
+			wantErr: normalize.ErrInvalidLocation,
+		},
+		{
+			name:    "invalid location",
+			loc:     "http://[::1",
+			wantErr: normalize.ErrInvalidLocation,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.normalizer.Normalize(tt.loc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidParam(t *testing.T) {
+	t.Parallel()
+
+	if _, err := normalize.New([]string{"["}, false, false); !errors.Is(err, normalize.ErrInvalidParam) {
+		t.Errorf("New() error = %v, want %v", err, normalize.ErrInvalidParam)
+	}
+}
+
+func TestNormalizer_ApplyDedupe(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := normalize.New(nil, false, true)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	urls := []sitemap.URL{
+		{Loc: "https://Example.com/a/"},
+		{Loc: "https://example.com:443/a"},
+		{Loc: "https://example.com/b#comments"},
+		{
+			Loc: "https://example.com/b",
+			Alternates: []sitemap.Alternate{
+				{Hreflang: "de", Href: "HTTPS://EXAMPLE.COM/de/b"},
+				{Hreflang: "fr", Href: "/fr/b"},
+			},
+		},
+		{
+			Loc: "https://example.com/c",
+			Alternates: []sitemap.Alternate{
+				{Hreflang: "de", Href: "HTTPS://EXAMPLE.COM/de/c"},
+				{Hreflang: "fr", Href: "/fr/c"},
+			},
+		},
+	}
+
+	normalized, err := normalizer.Apply(urls)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	got, duplicates := normalizer.Dedupe(normalized)
+
+	want := []sitemap.URL{
+		{Loc: "https://example.com/a/"},
+		{Loc: "https://example.com/b"},
+		{
+			Loc: "https://example.com/c",
+			Alternates: []sitemap.Alternate{
+				{Hreflang: "de", Href: "https://example.com/de/c"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) || duplicates != 2 {
+		t.Errorf("Dedupe() = %+v, %d, want %+v, 2", got, duplicates, want)
+	}
+
+	if _, err := normalizer.Apply([]sitemap.URL{{Loc: "https://example.com/"}, {Loc: "page"}}); !errors.Is(err, normalize.ErrInvalidLocation) {
+		t.Errorf("Apply() error = %v, want %v", err, normalize.ErrInvalidLocation)
+	}
+}
@@ -0,0 +1,110 @@
+// Package policy defines how the service chooses URLs and redirects visitors
+// to them: the available selection modes, the supported redirect status codes
+// and the limits of visitor history. It's shared by the configuration, which
+// validates settings against it, and the HTTP handlers, which implement it.
+package policy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Names of the built-in selection modes.
+const (
+	// ModeUniform gives every URL the same chance of being chosen.
+	ModeUniform = "uniform"
+
+	// ModePriority weights URLs by their sitemap priority.
+	ModePriority = "priority"
+
+	// ModeRecency favors URLs modified within a recency window.
+	ModeRecency = "recency"
+
+	// ModeShuffle goes through the URLs in a random order, without repeating
+	// any of them until every URL has been chosen.
+	ModeShuffle = "shuffle"
+
+	// ModeRoundRobin goes through the URLs in sitemap order.
+	ModeRoundRobin = "round-robin"
+
+	// ModeSeeded always chooses the same URL for the same seed.
+	ModeSeeded = "seeded"
+)
+
+// DefaultMode is the selection mode used when none is configured.
+const DefaultMode = ModeUniform
+
+// DefaultRecencyWindow is the default window within which recently modified
+// URLs are favored by the recency mode.
+const DefaultRecencyWindow = 90 * 24 * time.Hour
+
+// DefaultRedirectCacheControl is the default Cache-Control header of redirect
+// responses. Redirects are different for every request, so they must not be
+// cached.
+const DefaultRedirectCacheControl = "no-store"
+
+// MaxHistorySize is the maximum number of URLs remembered per visitor, which
+// keeps the history cookie well under the 4KB limit browsers enforce.
+const MaxHistorySize = 256
+
+// modes holds the names of the registered selection modes.
+var modes = struct { //nolint:gochecknoglobals // The registry must be shared by every caller of RegisterMode.
+	names map[string]struct{}
+	mu    sync.RWMutex
+}{
+	names: map[string]struct{}{
+		ModeUniform:    {},
+		ModePriority:   {},
+		ModeRecency:    {},
+		ModeShuffle:    {},
+		ModeRoundRobin: {},
+		ModeSeeded:     {},
+	},
+}
+
+// RegisterMode makes a selection mode valid in the configuration. It panics if
+// a mode with the same name is already registered.
+func RegisterMode(name string) {
+	modes.mu.Lock()
+	defer modes.mu.Unlock()
+
+	if _, ok := modes.names[name]; ok {
+		panic("policy: RegisterMode called twice for mode " + name)
+	}
+
+	modes.names[name] = struct{}{}
+}
+
+// IsMode reports whether name is a registered selection mode.
+func IsMode(name string) bool {
+	modes.mu.RLock()
+	defer modes.mu.RUnlock()
+
+	_, ok := modes.names[name]
+
+	return ok
+}
+
+// Modes returns the names of every registered selection mode, sorted.
+func Modes() []string {
+	modes.mu.RLock()
+	defer modes.mu.RUnlock()
+
+	names := make([]string, 0, len(modes.names))
+
+	for name := range modes.names {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// IsRedirectCode reports whether code is a supported redirect status code;
+// either 302, 303 or 307.
+func IsRedirectCode(code int) bool {
+	return code == http.StatusFound || code == http.StatusSeeOther || code == http.StatusTemporaryRedirect
+}
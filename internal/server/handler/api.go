@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// MaxCount is the maximum number of URLs APIHandler returns per request.
+const MaxCount = 50
+
+// CountParameter is the query parameter holding the number of URLs to return.
+const CountParameter = "count"
+
+// APIImage is an image in an APIResponse.
+type APIImage struct {
+	Loc string `json:"loc"`
+}
+
+// APIURL is a URL in an APIResponse, along with its sitemap metadata.
+type APIURL struct {
+	Loc        string     `json:"loc"`
+	LastMod    string     `json:"lastmod,omitempty"`
+	ChangeFreq string     `json:"changefreq,omitempty"`
+	Images     []APIImage `json:"images,omitempty"`
+	Priority   float64    `json:"priority"`
+}
+
+// APIResponse is the response of APIHandler.
+type APIResponse struct {
+	URLs []APIURL `json:"urls"`
+}
+
+// APIHandler returns one or more distinct URLs as JSON instead of redirecting
+// to them.
+type APIHandler struct {
+	sitemap  *cache.Sitemap
+	selector Selector
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+}
+
+// NewAPIHandler returns a new APIHandler instance. If selector is nil,
+// UniformSelector is used. Errors are recorded in collector, which may be nil.
+func NewAPIHandler(
+	sitemapCache *cache.Sitemap,
+	selector Selector,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+) *APIHandler {
+	if selector == nil {
+		selector = UniformSelector{}
+	}
+
+	return &APIHandler{
+		sitemap:  sitemapCache,
+		selector: selector,
+		metrics:  collector,
+		logger:   logger,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the API endpoint.
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Responses are meant to be used by widgets on other sites, and are
+	// different every time.
+	w.Header().Set(xhttp.AccessControlAllowOrigin, "*")
+	w.Header().Set(xhttp.CacheControl, "no-store")
+
+	count := 1
+
+	if value := r.URL.Query().Get(CountParameter); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > MaxCount {
+			response := xhttp.ResponseError{
+				Message: "Invalid count parameter; must be a number between 1 and " + strconv.Itoa(MaxCount) + ".",
+				Code:    http.StatusBadRequest,
+			}
+
+			response.Write(r.Context(), h.logger, w)
+
+			return
+		}
+
+		count = parsed
+	}
+
+	r, uris, ok := loadURLs(w, r, h.sitemap, h.metrics, h.logger)
+	if !ok {
+		return
+	}
+
+	response := APIResponse{
+		URLs: make([]APIURL, 0, count),
+	}
+
+	for _, u := range SelectDistinct(r, h.selector, uris, count) {
+		response.URLs = append(response.URLs, NewAPIURL(u))
+	}
+
+	writeJSON(r.Context(), h.logger, w, http.StatusOK, response)
+}
+
+// SelectDistinct chooses up to count distinct URLs with selector. Fewer URLs
+// are returned if the list doesn't have enough of them.
+func SelectDistinct(r *http.Request, selector Selector, urls []sitemap.URL, count int) []sitemap.URL {
+	if count > len(urls) {
+		count = len(urls)
+	}
+
+	var (
+		chosen = make([]sitemap.URL, 0, count)
+		seen   = make(map[uint32]struct{}, count)
+	)
+
+	for len(chosen) < count {
+		u := selectUnseen(r, selector, urls, seen)
+
+		hash := HashURL(u.Loc)
+		if _, ok := seen[hash]; ok {
+			// Every remaining URL collides with one already chosen.
+			break
+		}
+
+		seen[hash] = struct{}{}
+		chosen = append(chosen, u)
+	}
+
+	return chosen
+}
+
+// NewAPIURL returns the APIURL for a sitemap URL.
+func NewAPIURL(u sitemap.URL) APIURL {
+	apiURL := APIURL{
+		Loc:        u.Loc,
+		ChangeFreq: string(u.ChangeFreq),
+		Priority:   u.Priority,
+	}
+
+	if !u.LastMod.IsZero() {
+		apiURL.LastMod = u.LastMod.Format(time.RFC3339)
+	}
+
+	for _, image := range u.Images {
+		apiURL.Images = append(apiURL.Images, APIImage{
+			Loc: image.Loc,
+		})
+	}
+
+	return apiURL
+}
@@ -0,0 +1,144 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+        xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url>
+    <loc>http://example.com/page1</loc>
+    <lastmod>2023-01-02</lastmod>
+    <priority>0.8</priority>
+    <image:image>
+      <image:loc>http://example.com/image1.jpg</image:loc>
+    </image:image>
+  </url>
+  <url>
+    <loc>http://example.com/page2</loc>
+  </url>
+  <url>
+    <loc>http://example.com/page3</loc>
+  </url>
+</urlset>`
+
+// newTestCache returns a sitemap cache serving testSitemap.
+func newTestCache(t *testing.T) *cache.Sitemap {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(testSitemap))
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		logger   = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		client   = fetch.New("TestService", "test@example.com", 0)
+		resolver = sitemap.NewResolver(client, nil, 0)
+	)
+
+	return cache.New(resolver, nil, nil, nil, logger, srv.URL, time.Hour, 0, 0)
+}
+
+func TestAPIHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		h      = handler.NewAPIHandler(newTestCache(t), nil, nil, logger)
+	)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantURLs int
+	}{
+		{
+			name:     "default count",
+			wantCode: http.StatusOK,
+			wantURLs: 1,
+		},
+		{
+			name:     "several URLs",
+			query:    "?count=2",
+			wantCode: http.StatusOK,
+			wantURLs: 2,
+		},
+		{
+			name:     "more URLs than available",
+			query:    "?count=10",
+			wantCode: http.StatusOK,
+			wantURLs: 3,
+		},
+		{
+			name:     "zero count",
+			query:    "?count=0",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid count",
+			query:    "?count=many",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				rec = httptest.NewRecorder()
+				req = httptest.NewRequest(http.MethodGet, "/api/random"+tt.query, http.NoBody)
+			)
+
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("ServeHTTP() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var got handler.APIResponse
+
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+
+			if len(got.URLs) != tt.wantURLs {
+				t.Fatalf("ServeHTTP() got %d URLs, want %d", len(got.URLs), tt.wantURLs)
+			}
+
+			seen := make(map[string]struct{}, len(got.URLs))
+
+			for _, u := range got.URLs {
+				if _, ok := seen[u.Loc]; ok {
+					t.Errorf("ServeHTTP() returned %q more than once", u.Loc)
+				}
+
+				seen[u.Loc] = struct{}{}
+
+				if u.Loc == "http://example.com/page1" && (u.Priority != 0.8 || u.LastMod == "" || len(u.Images) != 1) {
+					t.Errorf("ServeHTTP() URL = %+v, want sitemap metadata", u)
+				}
+			}
+		})
+	}
+}
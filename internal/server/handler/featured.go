@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// Names of the endpoints that redirect visitors, used as the endpoint label of
+// the redirects metric.
+const (
+	EndpointRandom = "random"
+	EndpointDaily  = "daily"
+	EndpointHourly = "hourly"
+)
+
+// Durations of the time windows served by the featured endpoints.
+const (
+	// Daily is the time window of the daily endpoint.
+	Daily = 24 * time.Hour
+
+	// Hourly is the time window of the hourly endpoint.
+	Hourly = time.Hour
+)
+
+// FeaturedHandler redirects every visitor to the same URL for the duration of
+// a time window, such as a day, and to a different one in the next window.
+//
+// The URL depends only on the seed, the window and the URLs in the sitemap, so
+// it's stable across restarts and between instances sharing a seed. Windows
+// start at multiples of their duration since the zero time in UTC, so a daily
+// window starts at midnight UTC.
+type FeaturedHandler struct {
+	sitemap    *cache.Sitemap
+	redirector *Redirector
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
+
+	// chosen is the URL picked for the current window.
+	chosen sitemap.URL
+
+	// generation is the generation of the list chosen was picked from, used
+	// to tell whether the list changed since.
+	generation uint64
+
+	// chosenAt is the start of the window chosen was picked for.
+	chosenAt time.Time
+
+	seed   string
+	window time.Duration
+	mu     sync.Mutex
+}
+
+// NewFeaturedHandler returns a new FeaturedHandler instance that picks a new
+// URL every window.
+func NewFeaturedHandler(
+	sitemapCache *cache.Sitemap,
+	seed string,
+	window time.Duration,
+	redirector *Redirector,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+) *FeaturedHandler {
+	return &FeaturedHandler{
+		sitemap:    sitemapCache,
+		redirector: redirector,
+		metrics:    collector,
+		logger:     logger,
+		seed:       seed,
+		window:     window,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the featured endpoints.
+func (h *FeaturedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, uris, ok := loadURLs(w, r, h.sitemap, h.metrics, h.logger)
+	if !ok {
+		return
+	}
+
+	generation, _ := Generation(r)
+
+	uri := h.Featured(uris, generation, time.Now())
+
+	h.redirector.Redirect(w, r, uri.Loc)
+	h.metrics.Redirect(h.sitemap.URL(), h.endpoint())
+}
+
+// Featured returns the URL featured at the given time. The choice is kept for
+// the rest of the window unless generation, the generation of urls as
+// returned by cache.Sitemap.Snapshot, changes.
+func (h *FeaturedHandler) Featured(urls []sitemap.URL, generation uint64, now time.Time) sitemap.URL {
+	start := WindowStart(now, h.window)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.chosenAt.Equal(start) || h.generation != generation {
+		h.chosen = RendezvousURL(urls, h.seed+"\x00"+h.window.String()+"\x00"+start.Format(time.RFC3339))
+		h.generation = generation
+		h.chosenAt = start
+	}
+
+	return h.chosen
+}
+
+// endpoint returns the name of the endpoint served by the handler.
+func (h *FeaturedHandler) endpoint() string {
+	switch h.window {
+	case Daily:
+		return EndpointDaily
+	case Hourly:
+		return EndpointHourly
+	default:
+		return h.window.String()
+	}
+}
+
+// WindowStart returns the start of the time window of the given duration
+// that contains t.
+func WindowStart(t time.Time, window time.Duration) time.Time {
+	return t.UTC().Truncate(window)
+}
@@ -0,0 +1,110 @@
+package handler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestFeaturedHandler_Featured(t *testing.T) {
+	t.Parallel()
+
+	urls := make([]sitemap.URL, 0, 50)
+
+	for i := 0; i < cap(urls); i++ {
+		urls = append(urls, sitemap.URL{Loc: fmt.Sprintf("http://example.com/page%d", i)})
+	}
+
+	var (
+		first  = handler.NewFeaturedHandler(nil, "seed", handler.Daily, nil, nil, nil)
+		second = handler.NewFeaturedHandler(nil, "seed", handler.Daily, nil, nil, nil)
+		other  = handler.NewFeaturedHandler(nil, "other", handler.Daily, nil, nil, nil)
+		day    = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+		want   = first.Featured(urls, 1, day.Add(time.Hour))
+	)
+
+	if got := first.Featured(urls, 1, day.Add(23*time.Hour)); got.Loc != want.Loc {
+		t.Errorf("Featured() later in the day = %q, want %q", got.Loc, want.Loc)
+	}
+
+	if got := second.Featured(urls, 1, day.Add(12*time.Hour)); got.Loc != want.Loc {
+		t.Errorf("Featured() from another instance = %q, want %q", got.Loc, want.Loc)
+	}
+
+	// With 50 URLs, a week of picks with either seed is all but certain to
+	// differ at least once if the seed and window are taken into account.
+	var changed, seeded bool
+
+	for i := 1; i <= 7; i++ {
+		next := day.Add(time.Duration(i) * handler.Daily)
+
+		if first.Featured(urls, 1, next).Loc != want.Loc {
+			changed = true
+		}
+
+		if other.Featured(urls, 1, next).Loc != first.Featured(urls, 1, next).Loc {
+			seeded = true
+		}
+	}
+
+	if !changed {
+		t.Error("Featured() returned the same URL every day for a week")
+	}
+
+	if !seeded {
+		t.Error("Featured() returned the same URLs for different seeds")
+	}
+}
+
+func TestFeaturedHandler_FeaturedGeneration(t *testing.T) {
+	t.Parallel()
+
+	urls := make([]sitemap.URL, 0, 50)
+
+	for i := 0; i < cap(urls); i++ {
+		urls = append(urls, sitemap.URL{Loc: fmt.Sprintf("http://example.com/page%d", i)})
+	}
+
+	var (
+		h   = handler.NewFeaturedHandler(nil, "seed", handler.Daily, nil, nil, nil)
+		now = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	h.Featured(urls, 1, now)
+
+	// A refreshed list may reuse the backing array of the previous one, so
+	// only the generation tells the handler the list changed.
+	for i := range urls {
+		urls[i].Loc = fmt.Sprintf("http://example.com/refreshed%d", i)
+	}
+
+	if got := h.Featured(urls, 1, now); !strings.Contains(got.Loc, "/page") {
+		t.Errorf("Featured() with the same generation = %q, want the URL chosen before", got.Loc)
+	}
+
+	if got := h.Featured(urls, 2, now); !strings.Contains(got.Loc, "/refreshed") {
+		t.Errorf("Featured() with a new generation = %q, want a URL of the refreshed list", got.Loc)
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	t.Parallel()
+
+	var (
+		loc  = time.FixedZone("UTC-3", -3*60*60)
+		now  = time.Date(2023, 6, 1, 22, 30, 0, 0, loc)
+		want = time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)
+	)
+
+	if got := handler.WindowStart(now, handler.Daily); !got.Equal(want) {
+		t.Errorf("WindowStart() = %v, want %v", got, want)
+	}
+
+	if got := handler.WindowStart(now, handler.Hourly); !got.Equal(want.Add(time.Hour)) {
+		t.Errorf("WindowStart() = %v, want %v", got, want.Add(time.Hour))
+	}
+}
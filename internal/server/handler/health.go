@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred"
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// Site is a sitemap served by the service, as reported by the health and
+// status endpoints.
+type Site struct {
+	// Sitemap is the cache holding the sitemap's URLs.
+	Sitemap *cache.Sitemap
+
+	// Name is a human-readable name for the site.
+	Name string
+}
+
+// HealthResponse is the response of the health and readiness endpoints.
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// SitemapStatus is the state of a single sitemap in a StatusResponse.
+type SitemapStatus struct {
+	Name        string  `json:"name"`
+	URL         string  `json:"url"`
+	LastFetch   string  `json:"last_fetch,omitempty"`
+	LastError   string  `json:"last_error,omitempty"`
+	LastErrorAt string  `json:"last_error_at,omitempty"`
+	CacheAge    float64 `json:"cache_age_seconds"`
+	URLs        int     `json:"urls"`
+	Ready       bool    `json:"ready"`
+}
+
+// StatusResponse is the response of the status endpoint.
+type StatusResponse struct {
+	Name     string          `json:"name"`
+	Version  string          `json:"version"`
+	Sitemaps []SitemapStatus `json:"sitemaps"`
+	Ready    bool            `json:"ready"`
+}
+
+// HealthHandler is the HTTP handler for the liveness endpoint. It always
+// reports the service as healthy as long as it can serve requests.
+type HealthHandler struct {
+	logger *slog.Logger
+}
+
+// NewHealthHandler returns a new HealthHandler instance.
+func NewHealthHandler(logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		logger: logger,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the liveness endpoint.
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(xhttp.CacheControl, "no-store")
+
+	writeJSON(r.Context(), h.logger, w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// ReadyHandler is the HTTP handler for the readiness endpoint. It reports the
+// service as ready once every sitemap was loaded successfully at least once.
+type ReadyHandler struct {
+	logger *slog.Logger
+	sites  []Site
+}
+
+// NewReadyHandler returns a new ReadyHandler instance.
+func NewReadyHandler(sites []Site, logger *slog.Logger) *ReadyHandler {
+	return &ReadyHandler{
+		logger: logger,
+		sites:  sites,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the readiness endpoint.
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(xhttp.CacheControl, "no-store")
+
+	if !ready(h.sites) {
+		writeJSON(r.Context(), h.logger, w, http.StatusServiceUnavailable, HealthResponse{Status: "not ready"})
+
+		return
+	}
+
+	writeJSON(r.Context(), h.logger, w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// StatusHandler is the HTTP handler for the status endpoint, which reports
+// the state of every sitemap.
+type StatusHandler struct {
+	logger *slog.Logger
+	name   string
+	sites  []Site
+}
+
+// NewStatusHandler returns a new StatusHandler instance for the service with
+// the given name.
+func NewStatusHandler(name string, sites []Site, logger *slog.Logger) *StatusHandler {
+	return &StatusHandler{
+		logger: logger,
+		name:   name,
+		sites:  sites,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the status endpoint.
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(xhttp.CacheControl, "no-store")
+
+	var (
+		now      = time.Now()
+		response = StatusResponse{
+			Name:     h.name,
+			Version:  sitred.Version,
+			Sitemaps: make([]SitemapStatus, 0, len(h.sites)),
+			Ready:    ready(h.sites),
+		}
+	)
+
+	for _, site := range h.sites {
+		stats := site.Sitemap.Stats()
+
+		status := SitemapStatus{
+			Name:  site.Name,
+			URL:   site.Sitemap.URL(),
+			URLs:  stats.URLs,
+			Ready: stats.Ready(),
+		}
+
+		if stats.Ready() {
+			status.LastFetch = stats.FetchedAt.UTC().Format(time.RFC3339)
+			status.CacheAge = now.Sub(stats.FetchedAt).Seconds()
+		}
+
+		if stats.LastError != nil {
+			status.LastError = stats.LastError.Error()
+			status.LastErrorAt = stats.FailedAt.UTC().Format(time.RFC3339)
+		}
+
+		response.Sitemaps = append(response.Sitemaps, status)
+	}
+
+	writeJSON(r.Context(), h.logger, w, http.StatusOK, response)
+}
+
+// ready reports whether every site's sitemap was loaded at least once.
+func ready(sites []Site) bool {
+	for _, site := range sites {
+		if !site.Sitemap.Stats().Ready() {
+			return false
+		}
+	}
+
+	return true
+}
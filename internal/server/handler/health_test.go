@@ -0,0 +1,103 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+)
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		h      = handler.NewHealthHandler(logger)
+		w      = httptest.NewRecorder()
+	)
+
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		logger       = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		sitemapCache = newTestCache(t)
+		h            = handler.NewReadyHandler([]handler.Site{{Name: "default", Sitemap: sitemapCache}}, logger)
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP() before load status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if err := sitemapCache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("ServeHTTP() after load status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		logger       = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		sitemapCache = newTestCache(t)
+		h            = handler.NewStatusHandler("sitred", []handler.Site{{Name: "default", Sitemap: sitemapCache}}, logger)
+	)
+
+	if err := sitemapCache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var got handler.StatusResponse
+
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+
+	if got.Version != sitred.Version || !got.Ready {
+		t.Errorf("ServeHTTP() = %+v, want version %q and ready", got, sitred.Version)
+	}
+
+	if len(got.Sitemaps) != 1 {
+		t.Fatalf("ServeHTTP() got %d sitemaps, want 1", len(got.Sitemaps))
+	}
+
+	status := got.Sitemaps[0]
+
+	if status.Name != "default" || status.URL != sitemapCache.URL() || status.URLs != 3 {
+		t.Errorf("ServeHTTP() sitemap = %+v, want default with 3 URLs", status)
+	}
+
+	if status.LastFetch == "" || status.LastError != "" {
+		t.Errorf("ServeHTTP() sitemap = %+v, want a last fetch and no error", status)
+	}
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/policy"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+const (
+	// HistoryCookie is the name of the cookie holding a visitor's history.
+	HistoryCookie = "sitred_history"
+
+	// DefaultHistoryMaxAge is how long browsers keep the history cookie.
+	DefaultHistoryMaxAge = 30 * 24 * time.Hour
+
+	// maxRejections is the number of times selectUnseen asks the selector for
+	// another URL before filtering the list.
+	maxRejections = 8
+)
+
+// History remembers the URLs recently served to each visitor in a compact,
+// HMAC-signed cookie, so visitors aren't sent to a page they've already seen
+// until a number of other pages have been served to them.
+//
+// URLs are stored as 32-bit hashes, so two URLs may occasionally be mistaken
+// for one another, which at worst makes one of them less likely to be chosen.
+type History struct {
+	path   string
+	secret []byte
+	size   int
+}
+
+// NewHistory returns a new History remembering the last size URLs served to
+// each visitor, signing cookies with secret. If secret is empty, a random one
+// is generated, which invalidates every cookie once the History is replaced;
+// use RandomSecret to generate a secret that can be kept across Histories.
+//
+// Cookies are scoped to path, the URL path prefix the handlers using the
+// History are mounted at, so sites sharing a host under different prefixes
+// don't overwrite each other's history. An empty path is the same as "/".
+func NewHistory(secret []byte, size int, path string) (*History, error) {
+	if len(secret) == 0 {
+		var err error
+
+		secret, err = RandomSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if size > policy.MaxHistorySize {
+		size = policy.MaxHistorySize
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		path = "/"
+	}
+
+	return &History{
+		path:   path,
+		secret: secret,
+		size:   size,
+	}, nil
+}
+
+// RandomSecret returns a random secret suitable for signing history cookies.
+func RandomSecret() ([]byte, error) {
+	secret := make([]byte, sha256.Size)
+
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return secret, nil
+}
+
+// Read returns the hashes of the URLs recently served to the visitor, from
+// oldest to newest. Missing, malformed or forged cookies return an empty
+// history.
+func (h *History) Read(r *http.Request) []uint32 {
+	cookie, err := r.Cookie(HistoryCookie)
+	if err != nil {
+		return nil
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload)%4 != 0 {
+		return nil
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, h.sign(payload)) {
+		return nil
+	}
+
+	hashes := make([]uint32, 0, len(payload)/4)
+
+	for i := 0; i < len(payload); i += 4 {
+		hashes = append(hashes, binary.BigEndian.Uint32(payload[i:]))
+	}
+
+	return hashes
+}
+
+// Write stores the visitor's history in a cookie, keeping only the newest
+// entries.
+func (h *History) Write(w http.ResponseWriter, r *http.Request, hashes []uint32) {
+	if len(hashes) > h.size {
+		hashes = hashes[len(hashes)-h.size:]
+	}
+
+	payload := make([]byte, 0, len(hashes)*4)
+
+	for _, hash := range hashes {
+		payload = binary.BigEndian.AppendUint32(payload, hash)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     HistoryCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(h.sign(payload)),
+		Path:     h.path,
+		MaxAge:   int(DefaultHistoryMaxAge.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Select chooses a URL with selector that isn't in the visitor's history,
+// records it, and returns it.
+//
+// The selector is first asked for a URL a few times, and if every answer was
+// already seen, it's given only the URLs the visitor hasn't seen. If the
+// sitemap has fewer URLs than the history size, the oldest entries are
+// forgotten so there's always at least one URL to choose from.
+func (h *History) Select(w http.ResponseWriter, r *http.Request, selector Selector, urls []sitemap.URL) sitemap.URL {
+	var (
+		history = h.Read(r)
+		seen    = history
+	)
+
+	// Never exclude every URL.
+	if limit := len(urls) - 1; len(seen) > limit {
+		seen = seen[len(seen)-limit:]
+	}
+
+	recent := make(map[uint32]struct{}, len(seen))
+
+	for _, hash := range seen {
+		recent[hash] = struct{}{}
+	}
+
+	uri := selectUnseen(r, selector, urls, recent)
+
+	h.Write(w, r, append(history, HashURL(uri.Loc)))
+
+	return uri
+}
+
+// sign returns the HMAC of a cookie payload.
+func (h *History) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, h.secret)
+
+	_, _ = mac.Write(payload)
+
+	return mac.Sum(nil)
+}
+
+// HashURL returns the hash of a URL as stored in a visitor's history.
+func HashURL(loc string) uint32 {
+	h := fnv.New32a()
+
+	_, _ = h.Write([]byte(loc))
+
+	return h.Sum32()
+}
+
+// selectUnseen chooses a URL with selector whose hash isn't in recent,
+// falling back to any URL if hash collisions exclude all of them.
+func selectUnseen(r *http.Request, selector Selector, urls []sitemap.URL, recent map[uint32]struct{}) sitemap.URL {
+	if len(recent) == 0 {
+		return selector.Select(r, urls)
+	}
+
+	for i := 0; i < maxRejections; i++ {
+		uri := selector.Select(r, urls)
+
+		if _, ok := recent[HashURL(uri.Loc)]; !ok {
+			return uri
+		}
+	}
+
+	unseen := make([]sitemap.URL, 0, len(urls))
+
+	for _, u := range urls {
+		if _, ok := recent[HashURL(u.Loc)]; !ok {
+			unseen = append(unseen, u)
+		}
+	}
+
+	if len(unseen) == 0 {
+		return selector.Select(r, urls)
+	}
+
+	return selector.Select(r, unseen)
+}
@@ -0,0 +1,100 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestHistory_ReadWrite(t *testing.T) {
+	t.Parallel()
+
+	history, err := handler.NewHistory([]byte("test-secret"), 2, "")
+	if err != nil {
+		t.Fatalf("NewHistory() error = %v", err)
+	}
+
+	var (
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	)
+
+	history.Write(rec, req, []uint32{1, 2, 3})
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Write() set %d cookies, want 1", len(cookies))
+	}
+
+	if cookies[0].Path != "/" {
+		t.Errorf("Write() cookie path = %q, want %q", cookies[0].Path, "/")
+	}
+
+	req.AddCookie(cookies[0])
+
+	got := history.Read(req)
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("Read() = %v, want [2 3]", got)
+	}
+
+	other, err := handler.NewHistory([]byte("other-secret"), 2, "")
+	if err != nil {
+		t.Fatalf("NewHistory() error = %v", err)
+	}
+
+	if got := other.Read(req); len(got) != 0 {
+		t.Errorf("Read() with a different secret = %v, want empty history", got)
+	}
+
+	forged := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	forged.AddCookie(&http.Cookie{Name: handler.HistoryCookie, Value: "AAAAAQ.invalid"})
+
+	if got := history.Read(forged); len(got) != 0 {
+		t.Errorf("Read() with a forged cookie = %v, want empty history", got)
+	}
+}
+
+func TestHistory_Select(t *testing.T) {
+	t.Parallel()
+
+	urls := []sitemap.URL{
+		{Loc: "http://example.com/page1"},
+		{Loc: "http://example.com/page2"},
+		{Loc: "http://example.com/page3"},
+		{Loc: "http://example.com/page4"},
+		{Loc: "http://example.com/page5"},
+	}
+
+	history, err := handler.NewHistory(nil, len(urls)-1, "")
+	if err != nil {
+		t.Fatalf("NewHistory() error = %v", err)
+	}
+
+	var (
+		cookie *http.Cookie
+		seen   = make(map[string]struct{}, len(urls))
+	)
+
+	for i := 0; i < len(urls); i++ {
+		var (
+			rec = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		)
+
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		got := history.Select(rec, req, handler.UniformSelector{}, urls)
+
+		if _, ok := seen[got.Loc]; ok {
+			t.Fatalf("Select() repeated %q after %d redirects", got.Loc, i)
+		}
+
+		seen[got.Loc] = struct{}{}
+		cookie = rec.Result().Cookies()[0]
+	}
+}
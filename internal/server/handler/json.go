@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// writeJSON writes v as an indented JSON response with the given status code.
+func writeJSON(ctx context.Context, logger *slog.Logger, w http.ResponseWriter, code int, v any) {
+	js, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logger.LogAttrs(
+			ctx,
+			slog.LevelError,
+			"failed to encode response",
+			slog.String("error", err.Error()),
+		)
+
+		response := xhttp.ResponseError{
+			Message: "Failed to encode response.",
+			Code:    http.StatusInternalServerError,
+		}
+
+		response.Write(ctx, logger, w)
+
+		return
+	}
+
+	w.Header().Set(xhttp.ContentType, xhttp.ApplicationJSON)
+	w.WriteHeader(code)
+
+	if _, err := w.Write(js); err != nil {
+		logger.LogAttrs(
+			ctx,
+			slog.LevelError,
+			"failed to write response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
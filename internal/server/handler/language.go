@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// LanguageParameter is the query parameter visitors can use to choose a
+// language, overriding the Accept-Language header.
+const LanguageParameter = "lang"
+
+// DefaultHreflang is the hreflang value of the alternate meant for visitors
+// whose language doesn't match any other alternate.
+const DefaultHreflang = "x-default"
+
+// maxLanguages is the maximum number of languages read from an
+// Accept-Language header, so a huge header can't slow down redirects.
+const maxLanguages = 16
+
+// language is a language range from an Accept-Language header, along with
+// its quality value.
+type language struct {
+	tag     string
+	quality float64
+}
+
+// Localize returns the location of the localized version of u that best
+// matches the languages the visitor prefers, either from the lang query
+// parameter or from the Accept-Language header, based on the hreflang
+// alternates listed in the sitemap.
+//
+// If the visitor doesn't state a preference, or u doesn't have alternates,
+// Localize returns u.Loc. If none of the preferred languages match an
+// alternate, the x-default alternate is returned, if any, or u.Loc otherwise.
+func Localize(r *http.Request, u sitemap.URL) string {
+	if len(u.Alternates) == 0 {
+		return u.Loc
+	}
+
+	languages := preferredLanguages(r)
+	if len(languages) == 0 {
+		return u.Loc
+	}
+
+	for _, tag := range languages {
+		if tag == "*" {
+			return u.Loc
+		}
+
+		if href, ok := matchLanguage(tag, u.Alternates); ok {
+			return href
+		}
+	}
+
+	for _, alternate := range u.Alternates {
+		if strings.EqualFold(alternate.Hreflang, DefaultHreflang) {
+			return alternate.Href
+		}
+	}
+
+	return u.Loc
+}
+
+// matchLanguage returns the alternate that best matches tag. An alternate for
+// the exact language and region is preferred over one for the language alone,
+// which is preferred over one for the same language in a different region.
+func matchLanguage(tag string, alternates []sitemap.Alternate) (string, bool) {
+	base := baseLanguage(tag)
+
+	for _, alternate := range alternates {
+		if strings.EqualFold(alternate.Hreflang, tag) {
+			return alternate.Href, true
+		}
+	}
+
+	for _, alternate := range alternates {
+		if strings.EqualFold(alternate.Hreflang, base) {
+			return alternate.Href, true
+		}
+	}
+
+	for _, alternate := range alternates {
+		if strings.EqualFold(baseLanguage(alternate.Hreflang), base) {
+			return alternate.Href, true
+		}
+	}
+
+	return "", false
+}
+
+// baseLanguage returns the primary language subtag of tag, such as "pt" for
+// "pt-BR".
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+
+	return base
+}
+
+// preferredLanguages returns the languages the visitor prefers, from most to
+// least preferred. The lang query parameter takes precedence over the
+// Accept-Language header.
+func preferredLanguages(r *http.Request) []string {
+	if tag := strings.TrimSpace(r.URL.Query().Get(LanguageParameter)); tag != "" {
+		return []string{strings.ReplaceAll(tag, "_", "-")}
+	}
+
+	return parseAcceptLanguage(r.Header.Get(xhttp.AcceptedLanguage))
+}
+
+// parseAcceptLanguage parses an Accept-Language header and returns its
+// language ranges sorted by quality value, ignoring the ones the visitor
+// explicitly refuses with a quality value of zero.
+func parseAcceptLanguage(header string) []string {
+	var languages []language
+
+	for _, part := range strings.Split(header, ",") {
+		if len(languages) == maxLanguages {
+			break
+		}
+
+		tag, params, _ := strings.Cut(part, ";")
+
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+
+			quality = q
+		}
+
+		if quality == 0 {
+			continue
+		}
+
+		languages = append(languages, language{
+			tag:     tag,
+			quality: quality,
+		})
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	tags := make([]string, 0, len(languages))
+
+	for _, l := range languages {
+		tags = append(tags, l.tag)
+	}
+
+	return tags
+}
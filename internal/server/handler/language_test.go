@@ -0,0 +1,142 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestLocalize(t *testing.T) {
+	t.Parallel()
+
+	article := sitemap.URL{
+		Loc: "https://example.com/en/article",
+		Alternates: []sitemap.Alternate{
+			{Hreflang: "en", Href: "https://example.com/en/article"},
+			{Hreflang: "de", Href: "https://example.com/de/artikel"},
+			{Hreflang: "pt-PT", Href: "https://example.com/pt-pt/artigo"},
+			{Hreflang: "pt-BR", Href: "https://example.com/pt-br/artigo"},
+		},
+	}
+
+	withDefault := sitemap.URL{
+		Loc: "https://example.com/en/page",
+		Alternates: []sitemap.Alternate{
+			{Hreflang: "en", Href: "https://example.com/en/page"},
+			{Hreflang: "x-default", Href: "https://example.com/page"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		target         string
+		acceptLanguage string
+		uri            sitemap.URL
+		want           string
+	}{
+		{
+			name:   "no preference",
+			target: "/",
+			uri:    article,
+			want:   "https://example.com/en/article",
+		},
+		{
+			name:           "no alternates",
+			target:         "/",
+			acceptLanguage: "de",
+			uri:            sitemap.URL{Loc: "https://example.com/page"},
+			want:           "https://example.com/page",
+		},
+		{
+			name:           "exact match",
+			target:         "/",
+			acceptLanguage: "de",
+			uri:            article,
+			want:           "https://example.com/de/artikel",
+		},
+		{
+			name:           "case insensitive region match",
+			target:         "/",
+			acceptLanguage: "pt-br",
+			uri:            article,
+			want:           "https://example.com/pt-br/artigo",
+		},
+		{
+			name:           "base language match",
+			target:         "/",
+			acceptLanguage: "de-AT",
+			uri:            article,
+			want:           "https://example.com/de/artikel",
+		},
+		{
+			name:           "different region match",
+			target:         "/",
+			acceptLanguage: "pt",
+			uri:            article,
+			want:           "https://example.com/pt-pt/artigo",
+		},
+		{
+			name:           "quality values",
+			target:         "/",
+			acceptLanguage: "fr;q=0.9, en;q=0.5, de;q=0.8",
+			uri:            article,
+			want:           "https://example.com/de/artikel",
+		},
+		{
+			name:           "refused language",
+			target:         "/",
+			acceptLanguage: "de;q=0, en;q=0.1",
+			uri:            article,
+			want:           "https://example.com/en/article",
+		},
+		{
+			name:           "query parameter override",
+			target:         "/?lang=pt_BR",
+			acceptLanguage: "de",
+			uri:            article,
+			want:           "https://example.com/pt-br/artigo",
+		},
+		{
+			name:           "no match falls back to loc",
+			target:         "/",
+			acceptLanguage: "ja, fr;q=0.5",
+			uri:            article,
+			want:           "https://example.com/en/article",
+		},
+		{
+			name:           "no match falls back to x-default",
+			target:         "/",
+			acceptLanguage: "ja",
+			uri:            withDefault,
+			want:           "https://example.com/page",
+		},
+		{
+			name:           "wildcard",
+			target:         "/",
+			acceptLanguage: "ja, *;q=0.5",
+			uri:            withDefault,
+			want:           "https://example.com/en/page",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, http.NoBody)
+
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			if got := handler.Localize(r, tt.uri); got != tt.want {
+				t.Errorf("Localize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
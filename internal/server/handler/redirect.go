@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/policy"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// redirectPage is the HTML page served along with redirects, for clients that
+// don't follow the Location header.
+//
+//nolint:gochecknoglobals // Parsing the template once is cheaper than on every request.
+var redirectPage = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<meta name="robots" content="noindex">
+<title>Redirecting…</title>
+</head>
+<body>
+<p>Redirecting to <a href="{{.}}">{{.}}</a>.</p>
+</body>
+</html>
+`))
+
+// Redirector writes redirect responses.
+type Redirector struct {
+	cacheControl string
+	code         int
+	page         bool
+}
+
+// NewRedirector returns a new Redirector that redirects with the given status
+// code and Cache-Control header. If page is true, the response includes an
+// HTML page with a meta refresh tag and a link to the target, for clients
+// that don't follow the Location header.
+func NewRedirector(code int, cacheControl string, page bool) *Redirector {
+	if !policy.IsRedirectCode(code) {
+		code = http.StatusFound
+	}
+
+	return &Redirector{
+		cacheControl: cacheControl,
+		code:         code,
+		page:         page,
+	}
+}
+
+// Redirect redirects the request to uri. A nil Redirector redirects with a
+// 302 status code and policy.DefaultRedirectCacheControl.
+func (rd *Redirector) Redirect(w http.ResponseWriter, r *http.Request, uri string) {
+	if rd == nil {
+		rd = &Redirector{
+			cacheControl: policy.DefaultRedirectCacheControl,
+			code:         http.StatusFound,
+		}
+	}
+
+	if rd.cacheControl != "" {
+		w.Header().Set(xhttp.CacheControl, rd.cacheControl)
+	}
+
+	if !rd.page {
+		http.Redirect(w, r, uri, rd.code)
+
+		return
+	}
+
+	w.Header().Set(xhttp.Location, uri)
+	w.Header().Set(xhttp.ContentType, xhttp.TextHTML+"; "+xhttp.CharsetUTF8)
+	w.WriteHeader(rd.code)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_ = redirectPage.Execute(w, uri)
+}
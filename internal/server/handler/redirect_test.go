@@ -0,0 +1,103 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/policy"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+)
+
+func TestRedirector_Redirect(t *testing.T) {
+	t.Parallel()
+
+	const target = "https://example.com/page?a=1&b=2"
+
+	tests := []struct {
+		name       string
+		redirector *handler.Redirector
+		method     string
+		wantCode   int
+		wantCache  string
+		wantPage   bool
+	}{
+		{
+			name:      "nil redirector",
+			method:    http.MethodGet,
+			wantCode:  http.StatusFound,
+			wantCache: policy.DefaultRedirectCacheControl,
+		},
+		{
+			name:       "see other",
+			redirector: handler.NewRedirector(http.StatusSeeOther, "private, max-age=60", false),
+			method:     http.MethodGet,
+			wantCode:   http.StatusSeeOther,
+			wantCache:  "private, max-age=60",
+		},
+		{
+			name:       "unsupported status falls back to found",
+			redirector: handler.NewRedirector(http.StatusMovedPermanently, policy.DefaultRedirectCacheControl, false),
+			method:     http.MethodGet,
+			wantCode:   http.StatusFound,
+			wantCache:  policy.DefaultRedirectCacheControl,
+		},
+		{
+			name:       "html page",
+			redirector: handler.NewRedirector(http.StatusTemporaryRedirect, policy.DefaultRedirectCacheControl, true),
+			method:     http.MethodGet,
+			wantCode:   http.StatusTemporaryRedirect,
+			wantCache:  policy.DefaultRedirectCacheControl,
+			wantPage:   true,
+		},
+		{
+			name:       "html page without body for head requests",
+			redirector: handler.NewRedirector(http.StatusTemporaryRedirect, policy.DefaultRedirectCacheControl, true),
+			method:     http.MethodHead,
+			wantCode:   http.StatusTemporaryRedirect,
+			wantCache:  policy.DefaultRedirectCacheControl,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				rec = httptest.NewRecorder()
+				req = httptest.NewRequest(tt.method, "/", http.NoBody)
+			)
+
+			tt.redirector.Redirect(rec, req, target)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("Redirect() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if got := rec.Header().Get("Location"); got != target {
+				t.Errorf("Redirect() Location = %q, want %q", got, target)
+			}
+
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Redirect() Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+
+			if got := rec.Header().Values("Vary"); len(got) != 0 {
+				t.Errorf("Redirect() Vary = %q, want none", got)
+			}
+
+			body := rec.Body.String()
+
+			if gotPage := strings.Contains(body, `http-equiv="refresh"`); gotPage != tt.wantPage {
+				t.Errorf("Redirect() body = %q, want page %v", body, tt.wantPage)
+			}
+
+			if tt.wantPage && !strings.Contains(body, `href="https://example.com/page?a=1&amp;b=2"`) {
+				t.Errorf("Redirect() body = %q, want an escaped link to the target", body)
+			}
+		})
+	}
+}
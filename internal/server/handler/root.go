@@ -2,99 +2,74 @@ package handler
 
 import (
 	"log/slog"
-	"math/rand"
 	"net/http"
 
-	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
 	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
 	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
 )
 
 // RootHandler is the HTTP handler for the root endpoint.
 type RootHandler struct {
-	fetchClient *fetch.Client
-	logger      *slog.Logger
-	sitemapURL  string
+	sitemap    *cache.Sitemap
+	selector   Selector
+	history    *History
+	redirector *Redirector
+	metrics    *metrics.Metrics
+	logger     *slog.Logger
 }
 
-// NewRootHandler returns a new RootHandler instance.
-func NewRootHandler(fetchClient *fetch.Client, logger *slog.Logger, sitemapURL string) *RootHandler {
+// NewRootHandler returns a new RootHandler instance. If selector is nil,
+// UniformSelector is used, and if history isn't nil, visitors aren't
+// redirected to URLs they've recently been redirected to. A nil redirector
+// uses the defaults documented in Redirector.Redirect. Visitors are redirected
+// to the version of the chosen URL in their language, as documented in
+// Localize. Redirects and errors are recorded in collector, which may be nil.
+func NewRootHandler(
+	sitemapCache *cache.Sitemap,
+	selector Selector,
+	history *History,
+	redirector *Redirector,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+) *RootHandler {
+	if selector == nil {
+		selector = UniformSelector{}
+	}
+
 	return &RootHandler{
-		fetchClient: fetchClient,
-		logger:      logger,
-		sitemapURL:  sitemapURL,
+		sitemap:    sitemapCache,
+		selector:   selector,
+		history:    history,
+		redirector: redirector,
+		metrics:    collector,
+		logger:     logger,
 	}
 }
 
 // ServeHTTP handles HTTP requests for the root endpoint.
 func (h *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	data, err := h.fetchClient.Remote(r.Context(), h.sitemapURL)
-	if err != nil {
-		h.logger.LogAttrs(
-			r.Context(),
-			slog.LevelError,
-			"error fetching sitemap",
-			slog.String("url", h.sitemapURL),
-			slog.String("error", err.Error()),
-		)
-
-		response := xhttp.ResponseError{
-			Message: "Failed to fetch sitemap.",
-			Code:    http.StatusInternalServerError,
-		}
-
-		response.Write(r.Context(), h.logger, w)
-
-		return
-	}
-	defer data.Body.Close()
-
-	uris, err := sitemap.Parse(data.Body)
-	if err != nil {
-		h.logger.LogAttrs(
-			r.Context(),
-			slog.LevelError,
-			"error parsing sitemap",
-			slog.String("url", h.sitemapURL),
-			slog.String("error", err.Error()),
-		)
-
-		response := xhttp.ResponseError{
-			Message: "Failed to parse sitemap.",
-			Code:    http.StatusInternalServerError,
-		}
-
-		response.Write(r.Context(), h.logger, w)
-
+	r, uris, ok := loadURLs(w, r, h.sitemap, h.metrics, h.logger)
+	if !ok {
 		return
 	}
 
-	if len(uris) == 0 {
-		h.logger.LogAttrs(
-			r.Context(),
-			slog.LevelError,
-			"no URLs available for redirect",
-			slog.String("url", h.sitemapURL),
-		)
-
-		response := xhttp.ResponseError{
-			Message: "No URLs available for redirect.",
-			Code:    http.StatusInternalServerError,
-		}
+	var uri sitemap.URL
 
-		response.Write(r.Context(), h.logger, w)
+	if h.history != nil {
+		uri = h.history.Select(w, r, h.selector, uris)
 
-		return
+		// Redirects depend on the visitor history cookie, which only
+		// matters when visitor history is enabled.
+		w.Header().Add(xhttp.Vary, "Cookie")
+	} else {
+		uri = h.selector.Select(r, uris)
 	}
 
-	uri := RandomURL(uris)
-
-	http.Redirect(w, r, uri, http.StatusFound)
-}
-
-// RandomURL returns a random URL from the provided slice of URLs.
-func RandomURL(urls []string) string {
-	index := rand.Intn(len(urls)) //nolint:gosec // we don't need cryptographic randomness here
+	// Redirects are localized based on the visitor's language.
+	w.Header().Add(xhttp.Vary, xhttp.AcceptedLanguage)
 
-	return urls[index]
+	h.redirector.Redirect(w, r, Localize(r, uri))
+	h.metrics.Redirect(h.sitemap.URL(), EndpointRandom)
 }
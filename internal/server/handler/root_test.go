@@ -0,0 +1,62 @@
+package handler_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+)
+
+func TestRootHandler_Vary(t *testing.T) {
+	t.Parallel()
+
+	history, err := handler.NewHistory([]byte("test-secret"), 2, "")
+	if err != nil {
+		t.Fatalf("NewHistory() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		history  *handler.History
+		wantVary []string
+	}{
+		{
+			name:     "without visitor history",
+			wantVary: []string{"Accept-Language"},
+		},
+		{
+			name:     "with visitor history",
+			history:  history,
+			wantVary: []string{"Cookie", "Accept-Language"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+				h      = handler.NewRootHandler(newTestCache(t), nil, tt.history, nil, nil, logger)
+				rec    = httptest.NewRecorder()
+				req    = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			)
+
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusFound {
+				t.Fatalf("ServeHTTP() code = %d, want %d", rec.Code, http.StatusFound)
+			}
+
+			if got := rec.Header().Values("Vary"); !slices.Equal(got, tt.wantVary) {
+				t.Errorf("ServeHTTP() Vary = %q, want %q", got, tt.wantVary)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// route is a handler registered with a Router.
+type route struct {
+	handler http.Handler
+	host    string
+	prefix  string
+}
+
+// Router dispatches requests to handlers based on their Host header and URL
+// path prefix, allowing a single server to serve several sitemaps.
+type Router struct {
+	logger *slog.Logger
+	routes []route
+}
+
+// NewRouter returns a new Router instance.
+func NewRouter(logger *slog.Logger) *Router {
+	return &Router{
+		logger: logger,
+	}
+}
+
+// Handle registers a handler for requests matching host and prefix. An empty
+// host matches any host, and an empty prefix matches any path.
+//
+// The prefix is stripped from the request path before it's passed to the
+// handler, so handlers can be written as if they were mounted at the root.
+func (rt *Router) Handle(host, prefix string, handler http.Handler) {
+	rt.routes = append(rt.routes, route{
+		handler: handler,
+		host:    strings.ToLower(host),
+		prefix:  strings.TrimSuffix(prefix, "/"),
+	})
+
+	// Keep the most specific routes first: routes with a host before routes
+	// without one, then longer prefixes before shorter ones.
+	sort.SliceStable(rt.routes, func(i, j int) bool {
+		if (rt.routes[i].host == "") != (rt.routes[j].host == "") {
+			return rt.routes[i].host != ""
+		}
+
+		return len(rt.routes[i].prefix) > len(rt.routes[j].prefix)
+	})
+}
+
+// ServeHTTP dispatches the request to the first matching handler.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(r.Host)
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, route := range rt.routes {
+		if route.host != "" && route.host != host {
+			continue
+		}
+
+		path, ok := stripPrefix(r.URL.Path, route.prefix)
+		if !ok {
+			continue
+		}
+
+		if route.prefix == "" {
+			route.handler.ServeHTTP(w, r)
+
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+
+		route.handler.ServeHTTP(w, r2)
+
+		return
+	}
+
+	response := xhttp.ResponseError{
+		Message: "No sitemap configured for this address.",
+		Code:    http.StatusNotFound,
+	}
+
+	response.Write(r.Context(), rt.logger, w)
+}
+
+// stripPrefix removes prefix from path if path is inside of it.
+func stripPrefix(path, prefix string) (string, bool) {
+	if prefix == "" {
+		return path, true
+	}
+
+	if path == prefix {
+		return "/", true
+	}
+
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):], true
+	}
+
+	return "", false
+}
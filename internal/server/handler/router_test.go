@@ -0,0 +1,112 @@
+package handler_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+)
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+" "+r.URL.Path)
+		})
+	}
+
+	router := handler.NewRouter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router.Handle("", "", named("default"))
+	router.Handle("", "/docs", named("docs"))
+	router.Handle("blog.example.com", "", named("blog"))
+	router.Handle("blog.example.com", "/archive/", named("archive"))
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "default route",
+			target:   "http://example.com/",
+			wantCode: http.StatusOK,
+			wantBody: "default /",
+		},
+		{
+			name:     "prefix route",
+			target:   "http://example.com/docs",
+			wantCode: http.StatusOK,
+			wantBody: "docs /",
+		},
+		{
+			name:     "prefix route with subpath",
+			target:   "http://example.com/docs/daily",
+			wantCode: http.StatusOK,
+			wantBody: "docs /daily",
+		},
+		{
+			name:     "prefix must match whole segments",
+			target:   "http://example.com/docsearch",
+			wantCode: http.StatusOK,
+			wantBody: "default /docsearch",
+		},
+		{
+			name:     "host route with port",
+			target:   "http://BLOG.example.com:1997/",
+			wantCode: http.StatusOK,
+			wantBody: "blog /",
+		},
+		{
+			name:     "host and prefix route",
+			target:   "http://blog.example.com/archive/",
+			wantCode: http.StatusOK,
+			wantBody: "archive /",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				w = httptest.NewRecorder()
+				r = httptest.NewRequest(http.MethodGet, tt.target, http.NoBody)
+			)
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("ServeHTTP() code = %d, want %d", w.Code, tt.wantCode)
+			}
+
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("ServeHTTP() body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRouter_ServeHTTPNoMatch(t *testing.T) {
+	t.Parallel()
+
+	router := handler.NewRouter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router.Handle("blog.example.com", "", http.NotFoundHandler())
+
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+	)
+
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("ServeHTTP() code = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
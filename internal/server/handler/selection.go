@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// MinRecencyWeight is the weight RecencyWeight gives to URLs modified before
+// the recency window, or that don't have a modification date. Recently
+// modified URLs have a weight between MinRecencyWeight and 1.
+const MinRecencyWeight = 0.1
+
+// Weight returns how likely a URL is to be chosen, relative to other URLs.
+type Weight func(u sitemap.URL, now time.Time) float64
+
+// PriorityWeight weights a URL by its sitemap priority.
+func PriorityWeight(u sitemap.URL, _ time.Time) float64 {
+	return u.Priority
+}
+
+// RecencyWeight returns a Weight that favors URLs modified within window. The
+// weight decreases linearly from 1 for URLs modified now to MinRecencyWeight
+// for URLs modified at the start of the window.
+func RecencyWeight(window time.Duration) Weight {
+	return func(u sitemap.URL, now time.Time) float64 {
+		if u.LastMod.IsZero() || window <= 0 {
+			return MinRecencyWeight
+		}
+
+		age := now.Sub(u.LastMod)
+		if age <= 0 {
+			return 1
+		}
+
+		if age >= window {
+			return MinRecencyWeight
+		}
+
+		return 1 - (1-MinRecencyWeight)*float64(age)/float64(window)
+	}
+}
+
+// RandomURL returns a random URL from the provided slice of URLs.
+func RandomURL(urls []sitemap.URL) sitemap.URL {
+	index := rand.Intn(len(urls)) //nolint:gosec // we don't need cryptographic randomness here
+
+	return urls[index]
+}
+
+// WeightedURL returns a random URL from the provided slice of URLs, where the
+// chance of each URL being chosen is proportional to its weight. If every URL
+// has a weight of zero, WeightedURL falls back to RandomURL.
+func WeightedURL(urls []sitemap.URL, weight Weight, now time.Time) sitemap.URL {
+	var (
+		weights = make([]float64, len(urls))
+		total   float64
+	)
+
+	for i, u := range urls {
+		if w := weight(u, now); w > 0 {
+			weights[i] = w
+			total += w
+		}
+	}
+
+	if total <= 0 {
+		return RandomURL(urls)
+	}
+
+	target := rand.Float64() * total //nolint:gosec // we don't need cryptographic randomness here
+
+	for i, w := range weights {
+		if target < w {
+			return urls[i]
+		}
+
+		target -= w
+	}
+
+	// Floating point rounding can leave a tiny remainder; return the last URL
+	// with a positive weight.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return urls[i]
+		}
+	}
+
+	return RandomURL(urls)
+}
+
+// RendezvousURL returns the URL with the highest hash of key and its location,
+// so the same key always picks the same URL, and adding or removing other URLs
+// doesn't change the result.
+func RendezvousURL(urls []sitemap.URL, key string) sitemap.URL {
+	var (
+		best      int
+		bestScore uint64
+	)
+
+	for i, u := range urls {
+		h := fnv.New64a()
+
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(u.Loc))
+
+		if score := h.Sum64(); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return urls[best]
+}
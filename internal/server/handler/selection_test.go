@@ -0,0 +1,115 @@
+package handler_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestRecencyWeight(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now    = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+		window = 10 * 24 * time.Hour
+		weight = handler.RecencyWeight(window)
+	)
+
+	tests := []struct {
+		name    string
+		lastMod time.Time
+		want    float64
+	}{
+		{
+			name: "no modification date",
+			want: handler.MinRecencyWeight,
+		},
+		{
+			name:    "modified now",
+			lastMod: now,
+			want:    1,
+		},
+		{
+			name:    "modified halfway through the window",
+			lastMod: now.Add(-window / 2),
+			want:    1 - (1-handler.MinRecencyWeight)/2,
+		},
+		{
+			name:    "modified before the window",
+			lastMod: now.Add(-2 * window),
+			want:    handler.MinRecencyWeight,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := weight(sitemap.URL{LastMod: tt.lastMod}, now)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("RecencyWeight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedURL(t *testing.T) {
+	t.Parallel()
+
+	urls := []sitemap.URL{
+		{Loc: "http://example.com/never", Priority: 0},
+		{Loc: "http://example.com/always", Priority: 1},
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := handler.WeightedURL(urls, handler.PriorityWeight, time.Now()); got.Loc != urls[1].Loc {
+			t.Fatalf("WeightedURL() = %q, want %q", got.Loc, urls[1].Loc)
+		}
+	}
+
+	zero := []sitemap.URL{
+		{Loc: "http://example.com/page1"},
+		{Loc: "http://example.com/page2"},
+	}
+
+	if got := handler.WeightedURL(zero, handler.PriorityWeight, time.Now()); got.Loc == "" {
+		t.Error("WeightedURL() with zero weights returned an empty URL")
+	}
+}
+
+func TestRendezvousURL(t *testing.T) {
+	t.Parallel()
+
+	urls := []sitemap.URL{
+		{Loc: "http://example.com/page1"},
+		{Loc: "http://example.com/page2"},
+		{Loc: "http://example.com/page3"},
+	}
+
+	want := handler.RendezvousURL(urls, "seed")
+
+	// Removing a URL other than the chosen one doesn't change the result.
+	var (
+		remaining = make([]sitemap.URL, 0, len(urls)-1)
+		removed   = false
+	)
+
+	for _, u := range urls {
+		if u.Loc != want.Loc && !removed {
+			removed = true
+
+			continue
+		}
+
+		remaining = append(remaining, u)
+	}
+
+	if got := handler.RendezvousURL(remaining, "seed"); got.Loc != want.Loc {
+		t.Errorf("RendezvousURL() = %q after removing another URL, want %q", got.Loc, want.Loc)
+	}
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/policy"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+// ErrUnknownSelector is returned when a selector isn't registered.
+const ErrUnknownSelector xerrors.Error = "unknown selector"
+
+// SeedParameter is the query parameter SeededSelector combines with its seed.
+const SeedParameter = "seed"
+
+// generationKey is the context key of the generation of the list of URLs
+// passed to selectors.
+type generationKey struct{}
+
+// WithGeneration returns a shallow copy of r carrying generation, the
+// generation of the sitemap cache snapshot the URLs passed to selectors for r
+// come from, as returned by cache.Sitemap.Snapshot.
+func WithGeneration(r *http.Request, generation uint64) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), generationKey{}, generation))
+}
+
+// Generation returns the generation of the list of URLs passed to selectors
+// for r, if any. Selectors keeping state about the list can use it to tell
+// when the sitemap changed, even when they're given a subset of the list.
+func Generation(r *http.Request) (uint64, bool) {
+	generation, ok := r.Context().Value(generationKey{}).(uint64)
+
+	return generation, ok
+}
+
+// Selector chooses the URL a request is redirected to.
+type Selector interface {
+	// Select returns one of urls for the request. The list is never empty.
+	Select(r *http.Request, urls []sitemap.URL) sitemap.URL
+}
+
+// SelectorFunc is an adapter to allow the use of ordinary functions as a
+// Selector.
+type SelectorFunc func(r *http.Request, urls []sitemap.URL) sitemap.URL
+
+// Select implements the Selector interface.
+func (f SelectorFunc) Select(r *http.Request, urls []sitemap.URL) sitemap.URL {
+	return f(r, urls)
+}
+
+// SelectorOptions holds the settings available to a SelectorFactory.
+type SelectorOptions struct {
+	// Seed is the seed used by deterministic selectors.
+	Seed string
+
+	// RecencyWindow is the window within which recently modified URLs are
+	// favored.
+	RecencyWindow time.Duration
+}
+
+// SelectorFactory returns a new Selector configured with opts. Factories are
+// called once for every sitemap, so selectors may keep per-sitemap state.
+type SelectorFactory func(opts SelectorOptions) (Selector, error)
+
+// selectors holds the registered selector factories by selection mode.
+var selectors = struct { //nolint:gochecknoglobals // The registry must be shared by every caller of RegisterSelector.
+	factories map[string]SelectorFactory
+	mu        sync.RWMutex
+}{
+	factories: map[string]SelectorFactory{
+		policy.ModeUniform: func(SelectorOptions) (Selector, error) {
+			return UniformSelector{}, nil
+		},
+		policy.ModePriority: func(SelectorOptions) (Selector, error) {
+			return &WeightedSelector{Weight: PriorityWeight}, nil
+		},
+		policy.ModeRecency: func(opts SelectorOptions) (Selector, error) {
+			window := opts.RecencyWindow
+			if window <= 0 {
+				window = policy.DefaultRecencyWindow
+			}
+
+			return &WeightedSelector{Weight: RecencyWeight(window)}, nil
+		},
+		policy.ModeShuffle: func(SelectorOptions) (Selector, error) {
+			return &ShuffleSelector{}, nil
+		},
+		policy.ModeRoundRobin: func(SelectorOptions) (Selector, error) {
+			return &RoundRobinSelector{}, nil
+		},
+		policy.ModeSeeded: func(opts SelectorOptions) (Selector, error) {
+			return &SeededSelector{Seed: opts.Seed}, nil
+		},
+	},
+}
+
+// RegisterSelector makes a selector available by name to NewSelector, and
+// registers name as a selection mode with policy.RegisterMode so the
+// configuration accepts it. It panics if factory is nil or a selector with the
+// same name is already registered.
+//
+// As the handler package is internal, only selectors built into sitred can be
+// registered, usually from an init function next to their implementation. New
+// strategies don't need changes to RootHandler or the configuration, but they
+// can't be plugged in from outside the module.
+func RegisterSelector(name string, factory SelectorFactory) {
+	selectors.mu.Lock()
+	defer selectors.mu.Unlock()
+
+	if factory == nil {
+		panic("handler: RegisterSelector factory is nil")
+	}
+
+	if _, ok := selectors.factories[name]; ok {
+		panic("handler: RegisterSelector called twice for selector " + name)
+	}
+
+	policy.RegisterMode(name)
+
+	selectors.factories[name] = factory
+}
+
+// NewSelector returns a new instance of the selector registered as name, or
+// ErrUnknownSelector if there is none. An empty name is the same as
+// policy.DefaultMode.
+func NewSelector(name string, opts SelectorOptions) (Selector, error) {
+	if name == "" {
+		name = policy.DefaultMode
+	}
+
+	selectors.mu.RLock()
+	factory, ok := selectors.factories[name]
+	selectors.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSelector, name)
+	}
+
+	return factory(opts)
+}
+
+// UniformSelector gives every URL the same chance of being chosen.
+type UniformSelector struct{}
+
+// Select implements the Selector interface.
+func (UniformSelector) Select(_ *http.Request, urls []sitemap.URL) sitemap.URL {
+	return RandomURL(urls)
+}
+
+// WeightedSelector chooses URLs with a chance proportional to their weight.
+type WeightedSelector struct {
+	// Weight returns the weight of a URL.
+	Weight Weight
+}
+
+// Select implements the Selector interface.
+func (s *WeightedSelector) Select(_ *http.Request, urls []sitemap.URL) sitemap.URL {
+	return WeightedURL(urls, s.Weight, time.Now())
+}
+
+// ShuffleSelector goes through the URLs in a random order, without repeating
+// any of them until every URL has been chosen, at which point it starts over
+// with a new order.
+//
+// The order is reset whenever the generation of the list, as returned by
+// Generation, changes. When given a subset of the list, such as the URLs a
+// visitor hasn't seen yet, the next URL in the order that's part of the subset
+// is chosen.
+type ShuffleSelector struct {
+	urls       []sitemap.URL
+	order      []int
+	next       int
+	generation uint64
+	mu         sync.Mutex
+}
+
+// Select implements the Selector interface.
+func (s *ShuffleSelector) Select(r *http.Request, urls []sitemap.URL) sitemap.URL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	generation, _ := Generation(r)
+
+	if s.urls == nil || generation != s.generation || len(urls) > len(s.urls) {
+		s.urls = urls
+		s.generation = generation
+		s.shuffle()
+	}
+
+	if len(urls) == len(s.urls) {
+		return urls[s.advance()]
+	}
+
+	candidates := make(map[string]struct{}, len(urls))
+
+	for _, u := range urls {
+		candidates[u.Loc] = struct{}{}
+	}
+
+	// Look for a candidate among the URLs not chosen yet in this round, then
+	// in a new round if every candidate was already chosen.
+	for round := 0; round < 2; round++ {
+		for i := s.next; i < len(s.order); i++ {
+			if _, ok := candidates[s.urls[s.order[i]].Loc]; ok {
+				s.order[s.next], s.order[i] = s.order[i], s.order[s.next]
+
+				return s.urls[s.advance()]
+			}
+		}
+
+		s.shuffle()
+	}
+
+	// The URLs aren't part of the list at all.
+	return urls[0]
+}
+
+// shuffle starts a new round with a new random order.
+func (s *ShuffleSelector) shuffle() {
+	s.order = rand.Perm(len(s.urls)) //nolint:gosec // we don't need cryptographic randomness here
+	s.next = 0
+}
+
+// advance returns the index of the next URL in the order, starting a new round
+// if every URL was chosen.
+func (s *ShuffleSelector) advance() int {
+	if s.next >= len(s.order) {
+		s.shuffle()
+	}
+
+	i := s.order[s.next]
+	s.next++
+
+	return i
+}
+
+// RoundRobinSelector goes through the URLs in sitemap order.
+type RoundRobinSelector struct {
+	next atomic.Uint64
+}
+
+// Select implements the Selector interface.
+func (s *RoundRobinSelector) Select(_ *http.Request, urls []sitemap.URL) sitemap.URL {
+	return urls[(s.next.Add(1)-1)%uint64(len(urls))]
+}
+
+// SeededSelector always chooses the same URL for the same seed and seed query
+// parameter, until that URL is removed from the sitemap.
+type SeededSelector struct {
+	// Seed is the seed combined with the seed query parameter.
+	Seed string
+}
+
+// Select implements the Selector interface.
+func (s *SeededSelector) Select(r *http.Request, urls []sitemap.URL) sitemap.URL {
+	return RendezvousURL(urls, s.Seed+"\x00"+r.URL.Query().Get(SeedParameter))
+}
@@ -0,0 +1,179 @@
+package handler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/policy"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func testURLs() []sitemap.URL {
+	return []sitemap.URL{
+		{Loc: "http://example.com/page1", Priority: sitemap.DefaultPriority},
+		{Loc: "http://example.com/page2", Priority: sitemap.DefaultPriority},
+		{Loc: "http://example.com/page3", Priority: sitemap.DefaultPriority},
+	}
+}
+
+func TestNewSelector(t *testing.T) {
+	t.Parallel()
+
+	handler.RegisterSelector("test-first", func(handler.SelectorOptions) (handler.Selector, error) {
+		return handler.SelectorFunc(func(_ *http.Request, urls []sitemap.URL) sitemap.URL {
+			return urls[0]
+		}), nil
+	})
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: ""},
+		{name: policy.ModeUniform},
+		{name: policy.ModePriority},
+		{name: policy.ModeRecency},
+		{name: policy.ModeShuffle},
+		{name: policy.ModeRoundRobin},
+		{name: policy.ModeSeeded},
+		{name: "test-first", want: "http://example.com/page1"},
+		{name: "popularity", wantErr: handler.ErrUnknownSelector},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			selector, err := handler.NewSelector(tt.name, handler.SelectorOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			got := selector.Select(httptest.NewRequest(http.MethodGet, "/", http.NoBody), testURLs())
+			if got.Loc == "" {
+				t.Fatal("Select() returned an empty URL")
+			}
+
+			if tt.want != "" && got.Loc != tt.want {
+				t.Errorf("Select() = %q, want %q", got.Loc, tt.want)
+			}
+		})
+	}
+}
+
+func TestShuffleSelector(t *testing.T) {
+	t.Parallel()
+
+	var (
+		selector = &handler.ShuffleSelector{}
+		req      = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		urls     = testURLs()
+	)
+
+	for round := 0; round < 3; round++ {
+		seen := make(map[string]struct{}, len(urls))
+
+		for i := 0; i < len(urls); i++ {
+			seen[selector.Select(req, urls).Loc] = struct{}{}
+		}
+
+		if len(seen) != len(urls) {
+			t.Errorf("round %d chose %d distinct URLs, want %d", round, len(seen), len(urls))
+		}
+	}
+}
+
+func TestShuffleSelector_Generation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		selector = &handler.ShuffleSelector{}
+		req      = handler.WithGeneration(httptest.NewRequest(http.MethodGet, "/", http.NoBody), 1)
+		urls     = testURLs()
+		seen     = make(map[string]struct{}, len(urls))
+	)
+
+	// Selectors are given a freshly built list of the URLs not chosen yet, as
+	// History and SelectDistinct do, which must not reset the order.
+	for i := 0; i < len(urls); i++ {
+		unseen := make([]sitemap.URL, 0, len(urls))
+
+		for _, u := range testURLs() {
+			if _, ok := seen[u.Loc]; !ok {
+				unseen = append(unseen, u)
+			}
+		}
+
+		got := selector.Select(req, unseen)
+		if _, ok := seen[got.Loc]; ok {
+			t.Fatalf("Select() chose %q twice", got.Loc)
+		}
+
+		seen[got.Loc] = struct{}{}
+	}
+
+	// A copy of the list from the same generation continues the round, so
+	// every URL is chosen once more before any repeats.
+	seen = make(map[string]struct{}, len(urls))
+
+	for i := 0; i < len(urls); i++ {
+		seen[selector.Select(req, append([]sitemap.URL(nil), urls...)).Loc] = struct{}{}
+	}
+
+	if len(seen) != len(urls) {
+		t.Errorf("Select() chose %d distinct URLs, want %d", len(seen), len(urls))
+	}
+
+	// A new generation starts over with the new list.
+	var (
+		newReq  = handler.WithGeneration(httptest.NewRequest(http.MethodGet, "/", http.NoBody), 2)
+		newURLs = []sitemap.URL{{Loc: "http://example.com/page4"}}
+	)
+
+	if got := selector.Select(newReq, newURLs); got.Loc != "http://example.com/page4" {
+		t.Errorf("Select() = %q after a new generation, want %q", got.Loc, "http://example.com/page4")
+	}
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+	t.Parallel()
+
+	var (
+		selector = &handler.RoundRobinSelector{}
+		req      = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		urls     = testURLs()
+	)
+
+	for i := 0; i < 2*len(urls); i++ {
+		if got, want := selector.Select(req, urls).Loc, urls[i%len(urls)].Loc; got != want {
+			t.Errorf("Select() #%d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSeededSelector(t *testing.T) {
+	t.Parallel()
+
+	var (
+		selector = &handler.SeededSelector{Seed: "test"}
+		urls     = testURLs()
+		first    = selector.Select(httptest.NewRequest(http.MethodGet, "/?seed=a", http.NoBody), urls)
+	)
+
+	for i := 0; i < 10; i++ {
+		got := selector.Select(httptest.NewRequest(http.MethodGet, "/?seed=a", http.NoBody), urls)
+		if got.Loc != first.Loc {
+			t.Fatalf("Select() = %q, want %q for the same seed", got.Loc, first.Loc)
+		}
+	}
+}
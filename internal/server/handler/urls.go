@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+// loadURLs returns the list of URLs in the sitemap cache, along with a copy of
+// r carrying the generation of the list for selectors. If the sitemap cannot
+// be loaded or is empty, an error response is written and false is returned,
+// and the error is recorded in collector, which may be nil.
+func loadURLs(
+	w http.ResponseWriter,
+	r *http.Request,
+	sitemapCache *cache.Sitemap,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+) (*http.Request, []sitemap.URL, bool) {
+	uris, generation, err := sitemapCache.Snapshot(r.Context())
+	if err != nil && !errors.Is(err, sitemap.ErrSitemap) {
+		logger.LogAttrs(
+			r.Context(),
+			slog.LevelError,
+			"error fetching sitemap",
+			slog.String("url", sitemapCache.URL()),
+			slog.String("error", err.Error()),
+		)
+
+		collector.Error(sitemapCache.URL(), metrics.ReasonFetch)
+
+		response := xhttp.ResponseError{
+			Message: "Failed to fetch sitemap.",
+			Code:    http.StatusInternalServerError,
+		}
+
+		response.Write(r.Context(), logger, w)
+
+		return r, nil, false
+	}
+
+	if err != nil {
+		logger.LogAttrs(
+			r.Context(),
+			slog.LevelError,
+			"error parsing sitemap",
+			slog.String("url", sitemapCache.URL()),
+			slog.String("error", err.Error()),
+		)
+
+		collector.Error(sitemapCache.URL(), metrics.ReasonParse)
+
+		response := xhttp.ResponseError{
+			Message: "Failed to parse sitemap.",
+			Code:    http.StatusInternalServerError,
+		}
+
+		response.Write(r.Context(), logger, w)
+
+		return r, nil, false
+	}
+
+	if len(uris) == 0 {
+		logger.LogAttrs(
+			r.Context(),
+			slog.LevelError,
+			"no URLs available for redirect",
+			slog.String("url", sitemapCache.URL()),
+		)
+
+		collector.Error(sitemapCache.URL(), metrics.ReasonEmpty)
+
+		response := xhttp.ResponseError{
+			Message: "No URLs available for redirect.",
+			Code:    http.StatusInternalServerError,
+		}
+
+		response.Write(r.Context(), logger, w)
+
+		return r, nil, false
+	}
+
+	return WithGeneration(r, generation), uris, true
+}
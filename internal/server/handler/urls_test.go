@@ -0,0 +1,111 @@
+package handler_test
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestLoadURLs_Errors(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/relative.xml":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>/page1</loc></url>
+</urlset>`)
+		case "/index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/nested.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		case "/nested.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/relative.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name        string
+		path        string
+		wantMessage string
+		wantReason  string
+	}{
+		{
+			name:        "invalid location",
+			path:        "/relative.xml",
+			wantMessage: "Failed to parse sitemap.",
+			wantReason:  metrics.ReasonParse,
+		},
+		{
+			name:        "index beyond maximum depth",
+			path:        "/index.xml",
+			wantMessage: "Failed to parse sitemap.",
+			wantReason:  metrics.ReasonParse,
+		},
+		{
+			name:        "missing sitemap",
+			path:        "/missing.xml",
+			wantMessage: "Failed to fetch sitemap.",
+			wantReason:  metrics.ReasonFetch,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				logger       = slog.New(slog.NewTextHandler(os.Stderr, nil))
+				resolver     = sitemap.NewResolver(fetch.New("TestService", "test@example.com", 0), nil, 1)
+				sitemapCache = cache.New(resolver, nil, nil, nil, logger, srv.URL+tt.path, time.Hour, 0, 0)
+				collector    = metrics.New()
+				h            = handler.NewAPIHandler(sitemapCache, nil, collector, logger)
+				rec          = httptest.NewRecorder()
+			)
+
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/random", http.NoBody))
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("ServeHTTP() code = %d, want %d", rec.Code, http.StatusInternalServerError)
+			}
+
+			if body := rec.Body.String(); !strings.Contains(body, tt.wantMessage) {
+				t.Errorf("ServeHTTP() body = %q, want %q", body, tt.wantMessage)
+			}
+
+			var (
+				scrape = httptest.NewRecorder()
+				want   = fmt.Sprintf(`sitred_errors_total{sitemap=%q,reason=%q} 1`, srv.URL+tt.path, tt.wantReason)
+			)
+
+			collector.Handler(logger).ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+			if !strings.Contains(scrape.Body.String(), want) {
+				t.Errorf("metrics missing %q in:\n%s", want, scrape.Body.String())
+			}
+		})
+	}
+}
@@ -6,19 +6,25 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/certificate"
 	"git.sr.ht/~jamesponddotco/sitred/internal/config"
 	"git.sr.ht/~jamesponddotco/sitred/internal/endpoint"
-	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
 	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
 	"git.sr.ht/~jamesponddotco/xstd-go/xcrypto/xtls"
-	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp/xmiddleware"
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
 )
 
 const (
@@ -27,87 +33,148 @@ const (
 	DefaultIdleTimeout  = 60 * time.Second
 )
 
+// ErrReloadSitemap is returned when a sitemap fails to load while reloading
+// the configuration.
+const ErrReloadSitemap xerrors.Error = "failed to load sitemap while reloading configuration"
+
+// Loader returns a freshly read and validated configuration. It's called when
+// the server receives a SIGHUP.
+type Loader func() (*config.Config, error)
+
 // Server represents a Privytar server.
 type Server struct {
-	httpServer *http.Server
-	logger     *slog.Logger
-}
+	httpServer   *http.Server
+	handler      *reloadableHandler
+	certificates atomic.Pointer[certificate.Store]
+	cfg          atomic.Pointer[config.Config]
+	loader       Loader
+	logger       *slog.Logger
 
-// New creates a new HTTP server.
-func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
-	cert, err := tls.LoadX509KeyPair(cfg.Server.TLS.Certificate, cfg.Server.TLS.Key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
-	}
+	// metrics records metrics about the service across reloads.
+	metrics *metrics.Metrics
 
-	var tlsConfig *tls.Config
+	// metricsServer serves metrics on a separate listener, if configured.
+	metricsServer *http.Server
 
-	if cfg.Server.TLS.Version == "1.3" {
-		tlsConfig = xtls.ModernServerConfig()
+	// secret signs visitor history cookies if the configuration doesn't set
+	// a secret. It's generated once, so cookies survive reloads.
+	secret []byte
+
+	// sites are the sites currently served. The sites served when the server
+	// was created are loaded in the background on start, so the server
+	// becomes ready without waiting for the first request.
+	sites []*site
+
+	// mu serializes reloads and protects sites.
+	mu sync.Mutex
+}
+
+// New creates a new HTTP server. The loader is used to read the configuration
+// again when the server receives a SIGHUP, and may be nil to disable reloads.
+func New(cfg *config.Config, loader Loader, logger *slog.Logger) (*Server, error) {
+	collector := metrics.New()
+
+	secret, err := handler.RandomSecret()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
 	}
 
-	if cfg.Server.TLS.Version == "1.2" {
-		tlsConfig = xtls.IntermediateServerConfig()
+	mux, sites, err := newHandler(cfg, nil, secret, collector, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
 	}
 
-	tlsConfig.Certificates = []tls.Certificate{cert}
-
-	middlewares := []func(http.Handler) http.Handler{
-		func(h http.Handler) http.Handler { return xmiddleware.PanicRecovery(logger, h) },
-		func(h http.Handler) http.Handler { return xmiddleware.UserAgent(logger, h) },
-		func(h http.Handler) http.Handler {
-			return xmiddleware.AcceptRequests(
-				[]string{
-					http.MethodGet,
-					http.MethodHead,
-					http.MethodOptions,
-				},
-				logger,
-				h,
-			)
-		},
+	srv := &Server{
+		handler: &reloadableHandler{},
+		loader:  loader,
+		logger:  logger,
+		metrics: collector,
+		secret:  secret,
+		sites:   sites,
 	}
 
-	if cfg.Server.LogRequests {
-		accessLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	if cfg.Metrics.Address != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(endpoint.Metrics, collector.Handler(logger))
 
-		middlewares = append(middlewares, func(h http.Handler) http.Handler {
-			return xmiddleware.AccessLog(accessLogger, h)
-		})
+		srv.metricsServer = &http.Server{
+			Handler:      metricsMux,
+			ReadTimeout:  DefaultReadTimeout,
+			WriteTimeout: DefaultWriteTimeout,
+			IdleTimeout:  DefaultIdleTimeout,
+			ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		}
 	}
 
-	var (
-		fetchInstance = fetch.New(cfg.Service.Name, cfg.Service.Contact)
-		rootHandler   = handler.NewRootHandler(fetchInstance, logger, cfg.Sitemap.URL)
-	)
-
-	mux := http.NewServeMux()
-	mux.Handle(endpoint.Root, xmiddleware.Chain(rootHandler, middlewares...))
+	srv.handler.Store(mux)
+	srv.cfg.Store(cfg)
 
-	httpServer := &http.Server{
+	srv.httpServer = &http.Server{
 		Addr:         cfg.Server.Address,
-		Handler:      mux,
-		TLSConfig:    tlsConfig,
+		Handler:      srv.handler,
 		ReadTimeout:  DefaultReadTimeout,
 		WriteTimeout: DefaultWriteTimeout,
 		IdleTimeout:  DefaultIdleTimeout,
 		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
-	return &Server{
-		httpServer: httpServer,
-		logger:     logger,
-	}, nil
+	if cfg.Server.TLS.Disable {
+		return srv, nil
+	}
+
+	certificates, err := certificate.New(
+		cfg.Server.TLS.Certificate,
+		cfg.Server.TLS.Key,
+		cfg.Server.TLS.ReloadInterval,
+		logger,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	var tlsConfig *tls.Config
+
+	if cfg.Server.TLS.Version == "1.3" {
+		tlsConfig = xtls.ModernServerConfig()
+	}
+
+	if cfg.Server.TLS.Version == "1.2" {
+		tlsConfig = xtls.IntermediateServerConfig()
+	}
+
+	tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return srv.certificates.Load().GetCertificate(hello)
+	}
+
+	srv.certificates.Store(certificates)
+	srv.httpServer.TLSConfig = tlsConfig
+
+	return srv, nil
 }
 
 // Start starts the Privytar server.
 func (s *Server) Start() error {
 	var (
 		sigint            = make(chan os.Signal, 1)
+		sighup            = make(chan os.Signal, 1)
 		shutdownCompleted = make(chan struct{})
 	)
 
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	defer signal.Stop(sighup)
+
+	go func() {
+		for {
+			select {
+			case <-sighup:
+				s.reload()
+			case <-shutdownCompleted:
+				return
+			}
+		}
+	}()
 
 	go func() {
 		<-sigint
@@ -115,7 +182,7 @@ func (s *Server) Start() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if err := s.httpServer.Shutdown(ctx); err != nil {
+		if err := s.Stop(ctx); err != nil {
 			s.logger.LogAttrs(
 				ctx,
 				slog.LevelError,
@@ -127,7 +194,26 @@ func (s *Server) Start() error {
 		close(shutdownCompleted)
 	}()
 
-	if err := s.httpServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	listener, err := s.listen()
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	if err = s.serveMetrics(); err != nil {
+		_ = listener.Close()
+
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	s.warm()
+
+	if s.httpServer.TLSConfig != nil {
+		err = s.httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = s.httpServer.Serve(listener)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
@@ -136,11 +222,249 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// serveMetrics starts serving metrics on their own listener in the background,
+// if configured.
+func (s *Server) serveMetrics() error {
+	if s.metricsServer == nil {
+		return nil
+	}
+
+	network, address := s.cfg.Load().Metrics.Listen()
+
+	listener, err := listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.metricsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.LogAttrs(
+				context.Background(),
+				slog.LevelError,
+				"failed to serve metrics",
+				slog.String("error", err.Error()),
+			)
+		}
+	}()
+
+	return nil
+}
+
+// warm loads every sitemap served when the server was created in the
+// background, each within the refresh timeout of the configuration.
+func (s *Server) warm() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range s.sites {
+		go func(sitemapCache *cache.Sitemap) {
+			ctx := context.Background()
+
+			if err := sitemapCache.Refresh(ctx); err != nil {
+				s.logger.LogAttrs(
+					ctx,
+					slog.LevelWarn,
+					"failed to load sitemap on start",
+					slog.String("url", sitemapCache.URL()),
+					slog.String("error", err.Error()),
+				)
+			}
+		}(st.cache)
+	}
+}
+
+// listen creates the listener for the server, which is either a TCP socket or
+// a Unix domain socket.
+func (s *Server) listen() (net.Listener, error) {
+	return listen(s.cfg.Load().Server.Listen())
+}
+
+// listen creates a listener on the given network and address, as returned by
+// config.Server.Listen.
+func listen(network, address string) (net.Listener, error) {
+	if network == "unix" {
+		// Remove the socket left behind by a server that didn't shut down
+		// cleanly, as it would prevent us from listening. Anything else at
+		// that path is left alone, and makes listening fail.
+		info, err := os.Lstat(address)
+		if err == nil && info.Mode().Type() == fs.ModeSocket {
+			if err := os.Remove(address); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("%w", err)
+			}
+		}
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return listener, nil
+}
+
 // Stop gracefully shuts down the Privytar server.
 func (s *Server) Stop(ctx context.Context) error {
+	if s.metricsServer != nil {
+		if err := s.metricsServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shutdown metrics server: %w", err)
+		}
+	}
+
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to shutdown server: %w", err)
 	}
 
 	return nil
 }
+
+// Reload reads the configuration again, reloads the TLS certificate from disk,
+// and swaps in the new sitemap settings. In-flight requests and open
+// connections are not interrupted, and the current configuration is kept if
+// any step fails. Each new sitemap is given the refresh timeout of the new
+// configuration to load.
+func (s *Server) Reload(ctx context.Context) error {
+	if s.loader == nil {
+		return nil
+	}
+
+	cfg, err := s.loader()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	var certificates *certificate.Store
+
+	if !cfg.Server.TLS.Disable {
+		certificates, err = certificate.New(
+			cfg.Server.TLS.Certificate,
+			cfg.Server.TLS.Key,
+			cfg.Server.TLS.ReloadInterval,
+			s.logger,
+		)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mux, sites, err := newHandler(cfg, s.sites, s.secret, s.metrics, s.logger)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	// Load the new sitemaps before swapping them in, so requests don't have to
+	// wait for them, and keep serving the current ones if any of them fails to
+	// load rather than replacing working caches with empty ones. Sitemaps
+	// whose settings didn't change keep their cache, and aren't loaded again.
+	for _, site := range sites {
+		if s.serves(site.cache) {
+			continue
+		}
+
+		if err := site.cache.Refresh(ctx); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrReloadSitemap, site.cache.URL(), err)
+		}
+	}
+
+	// Sitemaps that are no longer served shouldn't be reported anymore.
+	s.metrics.ResetURLs()
+
+	for _, site := range sites {
+		if stats := site.cache.Stats(); stats.Ready() {
+			s.metrics.URLs(site.cache.URL(), stats.URLs)
+		}
+	}
+
+	s.warnRestartRequired(ctx, s.cfg.Load(), cfg)
+
+	if certificates != nil && s.httpServer.TLSConfig != nil {
+		s.certificates.Store(certificates)
+	}
+
+	s.handler.Store(mux)
+	s.cfg.Store(cfg)
+	s.sites = sites
+
+	return nil
+}
+
+// serves reports whether sitemapCache belongs to one of the sites currently
+// served. The caller must hold mu.
+func (s *Server) serves(sitemapCache *cache.Sitemap) bool {
+	for _, site := range s.sites {
+		if site.cache == sitemapCache {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handler returns the handler serving requests, which follows configuration
+// reloads.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// reload reloads the configuration and logs the outcome.
+func (s *Server) reload() {
+	ctx := context.Background()
+
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "reloading configuration")
+
+	if err := s.Reload(ctx); err != nil {
+		s.logger.LogAttrs(
+			ctx,
+			slog.LevelError,
+			"failed to reload configuration; keeping current configuration",
+			slog.String("error", err.Error()),
+		)
+
+		return
+	}
+
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "configuration reloaded")
+}
+
+// warnRestartRequired logs settings that changed but only take effect after a
+// restart.
+func (s *Server) warnRestartRequired(ctx context.Context, current, next *config.Config) {
+	changed := map[string]bool{
+		"server-address":  current.Server.Address != next.Server.Address,
+		"server-pid":      current.Server.PID != next.Server.PID,
+		"tls-version":     current.Server.TLS.Version != next.Server.TLS.Version,
+		"tls-disable":     current.Server.TLS.Disable != next.Server.TLS.Disable,
+		"metrics-address": current.Metrics.Address != next.Metrics.Address,
+	}
+
+	for name, ok := range changed {
+		if !ok {
+			continue
+		}
+
+		s.logger.LogAttrs(
+			ctx,
+			slog.LevelWarn,
+			"setting changed but requires a restart to take effect",
+			slog.String("setting", name),
+		)
+	}
+}
+
+// reloadableHandler is an http.Handler whose underlying handler can be
+// replaced while serving requests.
+type reloadableHandler struct {
+	current atomic.Pointer[http.ServeMux]
+}
+
+// Store replaces the underlying handler.
+func (h *reloadableHandler) Store(mux *http.ServeMux) {
+	h.current.Store(mux)
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.current.Load().ServeHTTP(w, r)
+}
@@ -0,0 +1,422 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/config"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server"
+)
+
+// testConfig returns a configuration serving the sitemap at sitemapURL.
+func testConfig(sitemapURL string, status int) *config.Config {
+	return &config.Config{
+		Service: &config.Service{
+			Name:    "TestService",
+			Contact: "test@example.com",
+		},
+		Server: &config.Server{
+			TLS: &config.TLS{
+				Disable: true,
+			},
+			Address:  "127.0.0.1:0",
+			CacheTTL: time.Hour,
+		},
+		Sitemap: &config.Sitemap{
+			URL: sitemapURL,
+		},
+		Redirect: &config.Redirect{
+			Status: status,
+		},
+		Visitor: &config.Visitor{},
+		Metrics: &config.Metrics{},
+	}
+}
+
+func TestServer_Reload(t *testing.T) {
+	t.Parallel()
+
+	var failing atomic.Bool
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() || r.URL.Path != "/sitemap.xml" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/page1</loc></url>
+</urlset>`)
+	}))
+	t.Cleanup(origin.Close)
+
+	var (
+		next   atomic.Pointer[config.Config]
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		loader = func() (*config.Config, error) { return next.Load(), nil }
+	)
+
+	srv, err := server.New(testConfig(origin.URL+"/sitemap.xml", http.StatusFound), loader, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	redirect := func(t *testing.T, wantCode int) {
+		t.Helper()
+
+		var (
+			rec = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		)
+
+		req.Header.Set("User-Agent", "TestClient")
+
+		srv.Handler().ServeHTTP(rec, req)
+
+		if rec.Code != wantCode {
+			t.Fatalf("ServeHTTP() code = %d, want %d", rec.Code, wantCode)
+		}
+
+		if got := rec.Header().Get("Location"); !strings.HasSuffix(got, "/page1") {
+			t.Errorf("ServeHTTP() Location = %q, want the sitemap's page", got)
+		}
+	}
+
+	redirect(t, http.StatusFound)
+
+	// A new sitemap that fails to load keeps the current one.
+	next.Store(testConfig(origin.URL+"/missing.xml", http.StatusTemporaryRedirect))
+
+	if err := srv.Reload(context.Background()); !errors.Is(err, server.ErrReloadSitemap) {
+		t.Fatalf("Reload() error = %v, want %v", err, server.ErrReloadSitemap)
+	}
+
+	redirect(t, http.StatusFound)
+
+	// An unchanged sitemap keeps its cache, even if the origin is down.
+	failing.Store(true)
+	next.Store(testConfig(origin.URL+"/sitemap.xml", http.StatusTemporaryRedirect))
+
+	if err := srv.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	redirect(t, http.StatusTemporaryRedirect)
+}
+
+func TestServer_ReloadHistory(t *testing.T) {
+	t.Parallel()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/page1</loc></url>
+  <url><loc>http://example.com/page2</loc></url>
+</urlset>`)
+	}))
+	t.Cleanup(origin.Close)
+
+	cfg := testConfig(origin.URL, http.StatusFound)
+	cfg.Visitor.History = 1
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		loader = func() (*config.Config, error) { return cfg, nil }
+	)
+
+	srv, err := server.New(cfg, loader, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	redirect := func(cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		var (
+			rec = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		)
+
+		req.Header.Set("User-Agent", "TestClient")
+
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		srv.Handler().ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	var (
+		first   = redirect()
+		seen    = first.Header().Get("Location")
+		cookies = first.Result().Cookies()
+	)
+
+	if len(cookies) == 0 {
+		t.Fatal("ServeHTTP() set no history cookie")
+	}
+
+	if err := srv.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	// Without a configured secret, cookies signed before the reload must still
+	// be accepted, so the visitor isn't sent to the page they've seen.
+	for i := 0; i < 8; i++ {
+		if got := redirect(cookies...).Header().Get("Location"); got == seen {
+			t.Fatalf("ServeHTTP() after reload redirected to %q again", got)
+		}
+	}
+}
+
+func TestServer_HistoryPrefixRoutes(t *testing.T) {
+	t.Parallel()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".xml")
+
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/%[1]s/page1</loc></url>
+  <url><loc>http://example.com/%[1]s/page2</loc></url>
+</urlset>`, site)
+	}))
+	t.Cleanup(origin.Close)
+
+	cfg := testConfig("", http.StatusFound)
+	cfg.Sitemap = &config.Sitemap{}
+	cfg.Visitor.History = 1
+	cfg.Routes = []*config.Route{
+		{Prefix: "/a", Sitemap: &config.Sitemap{URL: origin.URL + "/a.xml"}},
+		{Prefix: "/b", Sitemap: &config.Sitemap{URL: origin.URL + "/b.xml"}},
+	}
+
+	var (
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		loader = func() (*config.Config, error) { return cfg, nil }
+	)
+
+	srv, err := server.New(cfg, loader, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	frontend := httptest.NewServer(srv.Handler())
+	t.Cleanup(frontend.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar.New() error = %v", err)
+	}
+
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	redirect := func(t *testing.T, prefix string) string {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, frontend.URL+prefix+"/", http.NoBody)
+		if err != nil {
+			t.Fatalf("NewRequest() error = %v", err)
+		}
+
+		req.Header.Set("User-Agent", "TestClient")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("Do() code = %d, want %d", resp.StatusCode, http.StatusFound)
+		}
+
+		return resp.Header.Get("Location")
+	}
+
+	// Visiting the other route in between must not evict the history of the
+	// first one, so each route alternates between its two pages.
+	last := make(map[string]string, 2)
+
+	for i := 0; i < 8; i++ {
+		for _, prefix := range []string{"/a", "/b"} {
+			got := redirect(t, prefix)
+
+			if !strings.Contains(got, prefix+"/") {
+				t.Fatalf("ServeHTTP(%s) Location = %q, want a page of its sitemap", prefix, got)
+			}
+
+			if got == last[prefix] {
+				t.Fatalf("ServeHTTP(%s) redirected to %q twice in a row", prefix, got)
+			}
+
+			last[prefix] = got
+		}
+	}
+}
+
+func TestServer_StartUnix(t *testing.T) {
+	t.Parallel()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/page1</loc></url>
+</urlset>`)
+	}))
+	t.Cleanup(origin.Close)
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, path string)
+		wantErr bool
+	}{
+		{
+			name:  "no file",
+			setup: func(*testing.T, string) {},
+		},
+		{
+			name: "stale socket",
+			setup: func(t *testing.T, path string) {
+				t.Helper()
+
+				listener, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatalf("Listen() error = %v", err)
+				}
+
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+				if err := listener.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+			},
+		},
+		{
+			name: "regular file",
+			setup: func(t *testing.T, path string) {
+				t.Helper()
+
+				if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+					t.Fatalf("could not write file: %v", err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "sitred.sock")
+
+			tt.setup(t, path)
+
+			cfg := testConfig(origin.URL, http.StatusFound)
+			cfg.Server.Address = "unix:" + path
+
+			var (
+				logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+				loader = func() (*config.Config, error) { return cfg, nil }
+			)
+
+			srv, err := server.New(cfg, loader, logger)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			errc := make(chan error, 1)
+
+			go func() {
+				errc <- srv.Start()
+			}()
+
+			t.Cleanup(func() {
+				_ = srv.Stop(context.Background())
+			})
+
+			if tt.wantErr {
+				select {
+				case err := <-errc:
+					if err == nil {
+						t.Fatal("Start() error = nil, want an error")
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("Start() didn't fail")
+				}
+
+				if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+					t.Errorf("Start() removed or changed the file at the socket path")
+				}
+
+				return
+			}
+
+			client := &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var dialer net.Dialer
+
+						return dialer.DialContext(ctx, "unix", path)
+					},
+				},
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+
+			var resp *http.Response
+
+			for deadline := time.Now().Add(5 * time.Second); ; {
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://sitred/", http.NoBody)
+				if err != nil {
+					t.Fatalf("NewRequest() error = %v", err)
+				}
+
+				req.Header.Set("User-Agent", "TestClient")
+
+				resp, err = client.Do(req)
+				if err == nil {
+					break
+				}
+
+				if time.Now().After(deadline) {
+					t.Fatalf("Do() error = %v", err)
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusFound {
+				t.Errorf("Do() code = %d, want %d", resp.StatusCode, http.StatusFound)
+			}
+
+			if got := resp.Header.Get("Location"); got != "http://example.com/page1" {
+				t.Errorf("Do() Location = %q, want %q", got, "http://example.com/page1")
+			}
+		})
+	}
+}
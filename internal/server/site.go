@@ -0,0 +1,314 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/cache"
+	"git.sr.ht/~jamesponddotco/sitred/internal/config"
+	"git.sr.ht/~jamesponddotco/sitred/internal/endpoint"
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/metrics"
+	"git.sr.ht/~jamesponddotco/sitred/internal/server/handler"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp/xmiddleware"
+)
+
+// site represents a single sitemap served by the server.
+type site struct {
+	// cache is the cache holding the sitemap's URLs.
+	cache *cache.Sitemap
+
+	// handler serves every endpoint for the sitemap.
+	handler http.Handler
+
+	// name is a human-readable name for the site.
+	name string
+
+	// settings are the settings the cache was built from.
+	settings cacheSettings
+}
+
+// cacheSettings holds every setting a sitemap cache is built from, so the
+// cache can be kept across reloads when none of them changed.
+type cacheSettings struct {
+	// sitemap is the sitemap configuration, without the selection settings,
+	// which don't affect the cache.
+	sitemap config.Sitemap
+
+	// service is the service configuration, which identifies the client
+	// downloading the sitemap.
+	service config.Service
+
+	// cacheTTL is how long the sitemap is cached for.
+	cacheTTL time.Duration
+
+	// refreshTimeout is the maximum amount of time spent loading the sitemap.
+	refreshTimeout time.Duration
+
+	// fetchRate is the maximum number of sitemaps downloaded per second.
+	fetchRate float64
+}
+
+// newCacheSettings returns the settings of the cache for the given sitemap.
+func newCacheSettings(sitemapCfg *config.Sitemap, cfg *config.Config) cacheSettings {
+	settings := cacheSettings{
+		sitemap:        *sitemapCfg,
+		service:        *cfg.Service,
+		cacheTTL:       cfg.Server.CacheTTL,
+		refreshTimeout: cfg.Server.RefreshTimeout,
+		fetchRate:      cfg.Server.FetchRate,
+	}
+
+	settings.sitemap.Selection = nil
+
+	return settings
+}
+
+// previousCache returns the cache of the first of the previous sites built
+// from the same settings, or nil if there's none.
+func previousCache(previous []*site, settings cacheSettings) *cache.Sitemap {
+	for _, s := range previous {
+		if reflect.DeepEqual(s.settings, settings) {
+			return s.cache
+		}
+	}
+
+	return nil
+}
+
+// newSelector returns a new instance of the selector described by cfg. A nil
+// cfg returns a handler.UniformSelector.
+func newSelector(cfg *config.Selection) (handler.Selector, error) {
+	if cfg == nil {
+		return handler.UniformSelector{}, nil
+	}
+
+	selector, err := handler.NewSelector(cfg.Mode, handler.SelectorOptions{
+		Seed:          cfg.Seed,
+		RecencyWindow: cfg.RecencyWindow,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", config.ErrInvalidSelectionMode, err)
+	}
+
+	return selector, nil
+}
+
+// newHandler builds the handler for every endpoint of the service from the
+// given configuration and returns it along with the sites it serves. Metrics
+// are recorded in collector, and served by the handler unless the
+// configuration asks for a separate listener.
+//
+// The caches of the previous sites, if any, are reused by the new sites built
+// from the same settings, so unchanged sitemaps keep being served as is.
+// Visitor history cookies are signed with fallbackSecret if the configuration
+// doesn't set a secret.
+func newHandler(
+	cfg *config.Config,
+	previous []*site,
+	fallbackSecret []byte,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+) (*http.ServeMux, []*site, error) {
+	var (
+		panicRecovery = func(h http.Handler) http.Handler { return xmiddleware.PanicRecovery(logger, h) }
+		userAgent     = func(h http.Handler) http.Handler { return xmiddleware.UserAgent(logger, h) }
+		accept        = func(h http.Handler) http.Handler {
+			return xmiddleware.AcceptRequests(
+				[]string{
+					http.MethodGet,
+					http.MethodHead,
+					http.MethodOptions,
+				},
+				logger,
+				h,
+			)
+		}
+
+		middlewares = []func(http.Handler) http.Handler{panicRecovery, collector.Middleware, userAgent, accept}
+
+		// Probes don't always send a User-Agent header, so the health
+		// endpoints skip that check.
+		healthMiddlewares = []func(http.Handler) http.Handler{panicRecovery, accept}
+	)
+
+	if cfg.Server.LogRequests {
+		var (
+			accessLogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+			accessLog    = func(h http.Handler) http.Handler { return xmiddleware.AccessLog(accessLogger, h) }
+		)
+
+		middlewares = append(middlewares, accessLog)
+		healthMiddlewares = append(healthMiddlewares, accessLog)
+	}
+
+	historySecret := fallbackSecret
+
+	if cfg.Visitor != nil && cfg.Visitor.History > 0 {
+		if cfg.Visitor.Secret != "" {
+			historySecret = []byte(cfg.Visitor.Secret)
+		} else {
+			logger.Warn("visitor secret not set; history cookies won't survive a restart or work across replicas")
+		}
+	}
+
+	var (
+		redirector    = handler.NewRedirector(cfg.Redirect.Status, cfg.Redirect.CacheControl, cfg.Redirect.Page)
+		fetchInstance = fetch.New(cfg.Service.Name, cfg.Service.Contact, cfg.Server.FetchRate)
+		router        = handler.NewRouter(logger)
+		sites         = make([]*site, 0, len(cfg.Routes)+1)
+	)
+
+	for _, route := range cfg.Routes {
+		var (
+			settings = newCacheSettings(route.Sitemap, cfg)
+			reused   = previousCache(previous, settings)
+		)
+
+		history, err := newHistory(cfg.Visitor, historySecret, route.Prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s, err := newSite(route.Name(), route.Sitemap, cfg.Server, fetchInstance, reused, history, redirector, collector, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s.settings = settings
+
+		router.Handle(route.Host, route.Prefix, s.handler)
+
+		sites = append(sites, s)
+	}
+
+	if cfg.Sitemap.URL != "" {
+		var (
+			settings = newCacheSettings(cfg.Sitemap, cfg)
+			reused   = previousCache(previous, settings)
+		)
+
+		history, err := newHistory(cfg.Visitor, historySecret, "")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s, err := newSite("default", cfg.Sitemap, cfg.Server, fetchInstance, reused, history, redirector, collector, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s.settings = settings
+
+		router.Handle("", "", s.handler)
+
+		sites = append(sites, s)
+	}
+
+	healthSites := make([]handler.Site, 0, len(sites))
+
+	for _, s := range sites {
+		healthSites = append(healthSites, handler.Site{
+			Name:    s.name,
+			Sitemap: s.cache,
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(endpoint.Root, xmiddleware.Chain(router, middlewares...))
+	mux.Handle(endpoint.Healthz, xmiddleware.Chain(handler.NewHealthHandler(logger), healthMiddlewares...))
+	mux.Handle(endpoint.Readyz, xmiddleware.Chain(handler.NewReadyHandler(healthSites, logger), healthMiddlewares...))
+	mux.Handle(endpoint.Status, xmiddleware.Chain(handler.NewStatusHandler(cfg.Service.Name, healthSites, logger), healthMiddlewares...))
+
+	if cfg.Metrics.Address == "" {
+		mux.Handle(endpoint.Metrics, xmiddleware.Chain(collector.Handler(logger), healthMiddlewares...))
+	}
+
+	return mux, sites, nil
+}
+
+// newHistory returns the visitor history of the site mounted at prefix, signing
+// cookies with secret, or nil if visitor history is disabled.
+func newHistory(cfg *config.Visitor, secret []byte, prefix string) (*handler.History, error) {
+	if cfg == nil || cfg.History <= 0 {
+		return nil, nil //nolint:nilnil // A nil History disables visitor history.
+	}
+
+	history, err := handler.NewHistory(secret, cfg.History, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return history, nil
+}
+
+// newSite returns a site serving every endpoint for a single sitemap. If
+// sitemapCache isn't nil, it's used instead of a new cache.
+func newSite(
+	name string,
+	cfg *config.Sitemap,
+	serverCfg *config.Server,
+	fetchClient *fetch.Client,
+	sitemapCache *cache.Sitemap,
+	history *handler.History,
+	redirector *handler.Redirector,
+	collector *metrics.Metrics,
+	logger *slog.Logger,
+) (*site, error) {
+	parser, err := sitemap.ParserFor(sitemap.Format(cfg.Format), cfg.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	normalizer, err := cfg.Normalize.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	urlFilter, err := cfg.Filter.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	// Selectors may keep state about the URLs they chose, such as the order
+	// of ShuffleSelector, so every handler gets its own.
+	rootSelector, err := newSelector(cfg.Selection)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	apiSelector, err := newSelector(cfg.Selection)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if sitemapCache == nil {
+		resolver := sitemap.NewResolver(fetchClient, parser, cfg.MaxDepth)
+		sitemapCache = cache.New(resolver, normalizer, urlFilter, collector, logger, cfg.URL, serverCfg.CacheTTL, serverCfg.RefreshTimeout, cfg.SampleSize)
+	}
+
+	rootHandler := handler.NewRootHandler(sitemapCache, rootSelector, history, redirector, collector, logger)
+
+	var seed string
+
+	if cfg.Selection != nil {
+		seed = cfg.Selection.Seed
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(endpoint.Root, rootHandler)
+	mux.Handle(endpoint.Daily, handler.NewFeaturedHandler(sitemapCache, seed, handler.Daily, redirector, collector, logger))
+	mux.Handle(endpoint.Hourly, handler.NewFeaturedHandler(sitemapCache, seed, handler.Hourly, redirector, collector, logger))
+	mux.Handle(endpoint.APIRandom, handler.NewAPIHandler(sitemapCache, apiSelector, collector, logger))
+
+	return &site{
+		cache:   sitemapCache,
+		handler: mux,
+		name:    name,
+	}, nil
+}
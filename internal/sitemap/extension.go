@@ -0,0 +1,565 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XML namespaces of sitemaps and the extensions understood by the parser.
+const (
+	// NamespaceSitemap is the namespace of the sitemaps protocol.
+	NamespaceSitemap = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+	// NamespaceImage is the namespace of the Google image sitemap extension.
+	NamespaceImage = "http://www.google.com/schemas/sitemap-image/1.1"
+
+	// NamespaceVideo is the namespace of the Google video sitemap extension.
+	NamespaceVideo = "http://www.google.com/schemas/sitemap-video/1.1"
+
+	// NamespaceNews is the namespace of the Google news sitemap extension.
+	NamespaceNews = "http://www.google.com/schemas/sitemap-news/0.9"
+
+	// NamespaceXHTML is the namespace of the xhtml:link elements listing the
+	// localized versions of a page.
+	NamespaceXHTML = "http://www.w3.org/1999/xhtml"
+)
+
+// legacySitemapNamespaces are namespaces used by older versions of the
+// sitemaps protocol, or mistyped by popular generators, which are still found
+// in the wild.
+var legacySitemapNamespaces = []string{ //nolint:gochecknoglobals // Slices cannot be constants.
+	"https://www.sitemaps.org/schemas/sitemap/0.9",
+	"http://www.google.com/schemas/sitemap/0.84",
+	"http://www.google.com/schemas/sitemap/0.9",
+}
+
+// Image represents an image associated with a URL through the Google image
+// sitemap extension.
+type Image struct {
+	// Loc is the URL of the image.
+	Loc string
+
+	// Caption is the caption of the image.
+	Caption string
+
+	// Title is the title of the image.
+	Title string
+
+	// GeoLocation is the geographic location of the image, such as
+	// "Limerick, Ireland".
+	GeoLocation string
+
+	// License is the URL of the license of the image.
+	License string
+}
+
+// Video represents a video associated with a URL through the Google video
+// sitemap extension.
+type Video struct {
+	// PublicationDate is the date the video was first published. It's the
+	// zero time if the sitemap doesn't specify it.
+	PublicationDate time.Time
+
+	// ExpirationDate is the date after which the video is no longer
+	// available. It's the zero time if the sitemap doesn't specify it.
+	ExpirationDate time.Time
+
+	// ThumbnailLoc is the URL of the video's thumbnail.
+	ThumbnailLoc string
+
+	// Title is the title of the video.
+	Title string
+
+	// Description is the description of the video.
+	Description string
+
+	// ContentLoc is the URL of the video file.
+	ContentLoc string
+
+	// PlayerLoc is the URL of a player for the video.
+	PlayerLoc string
+
+	// Uploader is the name of the video's uploader.
+	Uploader string
+
+	// Tags are the tags describing the video.
+	Tags []string
+
+	// Duration is the duration of the video.
+	Duration time.Duration
+
+	// Rating is the rating of the video, between 0.0 and 5.0.
+	Rating float64
+
+	// ViewCount is the number of times the video was viewed.
+	ViewCount int64
+
+	// FamilyFriendly reports whether the video is suitable for every
+	// audience. It's true unless the sitemap says otherwise.
+	FamilyFriendly bool
+
+	// Live reports whether the video is a live stream.
+	Live bool
+}
+
+// News represents a news article through the Google news sitemap extension.
+type News struct {
+	// PublicationDate is the date the article was published.
+	PublicationDate time.Time
+
+	// PublicationName is the name of the news publication.
+	PublicationName string
+
+	// PublicationLanguage is the language of the publication, as an ISO 639
+	// code.
+	PublicationLanguage string
+
+	// Title is the title of the article.
+	Title string
+}
+
+// Alternate represents a localized version of a URL, listed with an
+// xhtml:link element.
+type Alternate struct {
+	// Hreflang is the language, and optionally the region, of the localized
+	// version, such as "de" or "pt-BR", or "x-default" for the fallback page.
+	Hreflang string
+
+	// Href is the URL of the localized version.
+	Href string
+}
+
+// inSpace reports whether name is in the given namespace. Elements whose
+// prefix was never declared are matched by their conventional prefix, as many
+// generators forget to declare extension namespaces.
+func inSpace(name xml.Name, namespace, prefix string) bool {
+	return name.Space == namespace || name.Space == prefix
+}
+
+// inSitemapSpace reports whether name is in the namespace of the sitemaps
+// protocol, a legacy version of it, or no namespace at all.
+func inSitemapSpace(name xml.Name) bool {
+	if name.Space == NamespaceSitemap || name.Space == "" {
+		return true
+	}
+
+	for _, namespace := range legacySitemapNamespaces {
+		if name.Space == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// children calls fn for every child element of the element whose start tag
+// was just read, until its end tag. fn must consume the child element, for
+// example with DecodeElement or Skip.
+func (d *xmlDecoder) children(fn func(elem xml.StartElement) error) error {
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		switch elem := t.(type) {
+		case xml.StartElement:
+			if err := fn(elem); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// text returns the trimmed character data of an element.
+func (d *xmlDecoder) text(elem xml.StartElement) (string, error) {
+	var value string
+
+	if err := d.DecodeElement(&value, &elem); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return strings.TrimSpace(value), nil
+}
+
+// skip skips an element, recording a violation as it isn't expected in
+// parent.
+func (d *xmlDecoder) skip(elem xml.StartElement, parent string) error {
+	d.violate(d.line(), "unexpected element <%s> in <%s>", elem.Name.Local, parent)
+
+	return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+}
+
+// decodeURL decodes the children of a url element whose start tag was just
+// read.
+func (d *xmlDecoder) decodeURL() (URL, error) {
+	var (
+		u = URL{
+			Priority: DefaultPriority,
+		}
+		line = d.line()
+		seen = make(map[string]bool, 4)
+	)
+
+	err := d.children(func(elem xml.StartElement) error {
+		switch {
+		case inSpace(elem.Name, NamespaceImage, "image") && elem.Name.Local == "image":
+			image, err := d.decodeImage()
+			if err != nil {
+				return err
+			}
+
+			u.Images = append(u.Images, image)
+		case inSpace(elem.Name, NamespaceVideo, "video") && elem.Name.Local == "video":
+			video, err := d.decodeVideo()
+			if err != nil {
+				return err
+			}
+
+			u.Videos = append(u.Videos, video)
+		case inSpace(elem.Name, NamespaceNews, "news") && elem.Name.Local == "news":
+			d.once(seen, "url", "news:news")
+
+			news, err := d.decodeNews()
+			if err != nil {
+				return err
+			}
+
+			u.News = &news
+		case inSpace(elem.Name, NamespaceXHTML, "xhtml") && elem.Name.Local == "link":
+			if alternate, ok := d.decodeAlternate(elem); ok {
+				u.Alternates = append(u.Alternates, alternate)
+			}
+
+			return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+		case inSitemapSpace(elem.Name):
+			return d.decodeURLField(elem, &u, seen)
+		default:
+			return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+		}
+
+		return nil
+	})
+
+	if err == nil && u.Loc == "" {
+		d.violate(line, "<url> is missing <loc>")
+	}
+
+	return u, err
+}
+
+// decodeURLField decodes one of the elements defined by the sitemaps protocol
+// for url elements into u. Unknown elements are skipped.
+func (d *xmlDecoder) decodeURLField(elem xml.StartElement, u *URL, seen map[string]bool) error {
+	switch elem.Name.Local {
+	case "loc", "lastmod", "changefreq", "priority":
+	default:
+		return d.skip(elem, "url")
+	}
+
+	d.once(seen, "url", elem.Name.Local)
+
+	line := d.line()
+
+	value, err := d.text(elem)
+	if err != nil {
+		return err
+	}
+
+	switch elem.Name.Local {
+	case "loc":
+		d.checkLoc(line, "loc", value)
+
+		u.Loc = value
+	case "lastmod":
+		d.checkLastMod(line, "lastmod", value)
+
+		u.LastMod = ParseLastMod(value)
+	case "changefreq":
+		d.checkChangeFreq(line, value)
+
+		u.ChangeFreq = ChangeFreq(strings.ToLower(value))
+	case "priority":
+		d.checkPriority(line, value)
+
+		u.Priority = parsePriority(value)
+	}
+
+	return nil
+}
+
+// decodeSitemap decodes the children of a sitemap element in a sitemap index
+// whose start tag was just read, and returns its location.
+func (d *xmlDecoder) decodeSitemap() (string, error) {
+	var (
+		loc  string
+		line = d.line()
+		seen = make(map[string]bool, 2)
+	)
+
+	err := d.children(func(elem xml.StartElement) error {
+		if !inSitemapSpace(elem.Name) {
+			return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+		}
+
+		if elem.Name.Local != "loc" && elem.Name.Local != "lastmod" {
+			return d.skip(elem, "sitemap")
+		}
+
+		d.once(seen, "sitemap", elem.Name.Local)
+
+		valueLine := d.line()
+
+		value, err := d.text(elem)
+		if err != nil {
+			return err
+		}
+
+		if elem.Name.Local == "lastmod" {
+			d.checkLastMod(valueLine, "lastmod", value)
+
+			return nil
+		}
+
+		d.checkLoc(valueLine, "loc", value)
+
+		loc = value
+
+		return nil
+	})
+
+	if err == nil && loc == "" {
+		d.violate(line, "<sitemap> is missing <loc>")
+	}
+
+	return loc, err
+}
+
+// decodeImage decodes the children of an image:image element.
+func (d *xmlDecoder) decodeImage() (Image, error) {
+	var (
+		image Image
+		line  = d.line()
+	)
+
+	err := d.children(func(elem xml.StartElement) error {
+		if !inSpace(elem.Name, NamespaceImage, "image") {
+			return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+		}
+
+		valueLine := d.line()
+
+		value, err := d.text(elem)
+		if err != nil {
+			return err
+		}
+
+		switch elem.Name.Local {
+		case "loc":
+			d.checkLoc(valueLine, "image:loc", value)
+
+			image.Loc = value
+		case "caption":
+			image.Caption = value
+		case "title":
+			image.Title = value
+		case "geo_location":
+			image.GeoLocation = value
+		case "license":
+			image.License = value
+		}
+
+		return nil
+	})
+
+	if err == nil && image.Loc == "" {
+		d.violate(line, "<image:image> is missing <image:loc>")
+	}
+
+	return image, err
+}
+
+// decodeVideo decodes the children of a video:video element.
+func (d *xmlDecoder) decodeVideo() (Video, error) {
+	var (
+		video = Video{
+			FamilyFriendly: true,
+		}
+		line = d.line()
+	)
+
+	err := d.children(func(elem xml.StartElement) error {
+		if !inSpace(elem.Name, NamespaceVideo, "video") {
+			return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+		}
+
+		value, err := d.text(elem)
+		if err != nil {
+			return err
+		}
+
+		switch elem.Name.Local {
+		case "thumbnail_loc":
+			video.ThumbnailLoc = value
+		case "title":
+			video.Title = value
+		case "description":
+			video.Description = value
+		case "content_loc":
+			video.ContentLoc = value
+		case "player_loc":
+			video.PlayerLoc = value
+		case "uploader":
+			video.Uploader = value
+		case "tag":
+			video.Tags = append(video.Tags, value)
+		case "duration":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+				video.Duration = time.Duration(seconds) * time.Second
+			}
+		case "rating":
+			if rating, err := strconv.ParseFloat(value, 64); err == nil && rating >= 0 && rating <= 5 {
+				video.Rating = rating
+			}
+		case "view_count":
+			if views, err := strconv.ParseInt(value, 10, 64); err == nil && views >= 0 {
+				video.ViewCount = views
+			}
+		case "publication_date":
+			video.PublicationDate = ParseLastMod(value)
+		case "expiration_date":
+			video.ExpirationDate = ParseLastMod(value)
+		case "family_friendly":
+			video.FamilyFriendly = !strings.EqualFold(value, "no")
+		case "live":
+			video.Live = strings.EqualFold(value, "yes")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return video, err
+	}
+
+	switch {
+	case video.ThumbnailLoc == "":
+		d.violate(line, "<video:video> is missing <video:thumbnail_loc>")
+	case video.Title == "":
+		d.violate(line, "<video:video> is missing <video:title>")
+	case video.Description == "":
+		d.violate(line, "<video:video> is missing <video:description>")
+	case video.ContentLoc == "" && video.PlayerLoc == "":
+		d.violate(line, "<video:video> is missing both <video:content_loc> and <video:player_loc>")
+	}
+
+	return video, nil
+}
+
+// decodeNews decodes the children of a news:news element.
+func (d *xmlDecoder) decodeNews() (News, error) {
+	var (
+		news News
+		line = d.line()
+	)
+
+	err := d.children(func(elem xml.StartElement) error {
+		if !inSpace(elem.Name, NamespaceNews, "news") {
+			return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+		}
+
+		if elem.Name.Local == "publication" {
+			return d.children(func(elem xml.StartElement) error {
+				if !inSpace(elem.Name, NamespaceNews, "news") {
+					return d.Skip() //nolint:wrapcheck // Wrapped by the caller.
+				}
+
+				value, err := d.text(elem)
+				if err != nil {
+					return err
+				}
+
+				switch elem.Name.Local {
+				case "name":
+					news.PublicationName = value
+				case "language":
+					news.PublicationLanguage = value
+				}
+
+				return nil
+			})
+		}
+
+		valueLine := d.line()
+
+		value, err := d.text(elem)
+		if err != nil {
+			return err
+		}
+
+		switch elem.Name.Local {
+		case "publication_date":
+			d.checkLastMod(valueLine, "news:publication_date", value)
+
+			news.PublicationDate = ParseLastMod(value)
+		case "title":
+			news.Title = value
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return news, err
+	}
+
+	switch {
+	case news.PublicationName == "" || news.PublicationLanguage == "":
+		d.violate(line, "<news:news> is missing the name or language of <news:publication>")
+	case news.PublicationDate.IsZero():
+		d.violate(line, "<news:news> is missing <news:publication_date>")
+	case news.Title == "":
+		d.violate(line, "<news:news> is missing <news:title>")
+	}
+
+	return news, nil
+}
+
+// decodeAlternate returns the localized version of a URL listed by an
+// xhtml:link element, if it's a valid alternate link.
+func (d *xmlDecoder) decodeAlternate(elem xml.StartElement) (Alternate, bool) {
+	var (
+		alternate Alternate
+		rel       string
+	)
+
+	for _, attr := range elem.Attr {
+		switch attr.Name.Local {
+		case "rel":
+			rel = strings.TrimSpace(attr.Value)
+		case "hreflang":
+			alternate.Hreflang = strings.TrimSpace(attr.Value)
+		case "href":
+			alternate.Href = strings.TrimSpace(attr.Value)
+		}
+	}
+
+	if !strings.EqualFold(rel, "alternate") {
+		return Alternate{}, false
+	}
+
+	if alternate.Hreflang == "" || alternate.Href == "" {
+		d.violate(d.line(), "alternate <xhtml:link> is missing hreflang or href")
+
+		return Alternate{}, false
+	}
+
+	d.checkLoc(d.line(), "xhtml:link", alternate.Href)
+
+	return alternate, true
+}
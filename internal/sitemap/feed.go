@@ -0,0 +1,207 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// pubDateLayouts are the RFC 822 layouts accepted in RSS pubDate elements.
+var pubDateLayouts = []string{ //nolint:gochecknoglobals // Slices cannot be constants.
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+}
+
+// RSSParser parses RSS feeds, using the link of every item as a URL and its
+// publication date as the URL's last modification date.
+type RSSParser struct{}
+
+// Parse implements the Parser interface.
+func (p RSSParser) Parse(r io.Reader) (*Document, error) {
+	return collect(r, p.Walk)
+}
+
+// Walk implements the Parser interface.
+func (RSSParser) Walk(r io.Reader, fn WalkFunc) (*Document, error) {
+	var (
+		decoder = xml.NewDecoder(r)
+		current URL
+		inItem  = false
+	)
+
+	for {
+		t, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+		}
+
+		switch elem := t.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "item":
+				inItem = true
+				current = URL{
+					Priority: DefaultPriority,
+				}
+			case "link", "pubDate":
+				if !inItem {
+					continue
+				}
+
+				var value string
+
+				if err := decoder.DecodeElement(&value, &elem); err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+				}
+
+				if elem.Name.Local == "link" {
+					if link := strings.TrimSpace(value); link != "" && current.Loc == "" {
+						current.Loc = link
+					}
+				} else {
+					current.LastMod = parsePubDate(value)
+				}
+			}
+		case xml.EndElement:
+			if elem.Name.Local == "item" {
+				if inItem && current.Loc != "" {
+					if err := fn(current); err != nil {
+						return nil, fmt.Errorf("%w", err)
+					}
+				}
+
+				inItem = false
+			}
+		}
+	}
+
+	return &Document{}, nil
+}
+
+// AtomParser parses Atom feeds, using the alternate link of every entry as a
+// URL and the date it was updated as the URL's last modification date.
+type AtomParser struct{}
+
+// Parse implements the Parser interface.
+func (p AtomParser) Parse(r io.Reader) (*Document, error) {
+	return collect(r, p.Walk)
+}
+
+// Walk implements the Parser interface.
+func (AtomParser) Walk(r io.Reader, fn WalkFunc) (*Document, error) {
+	var (
+		decoder   = xml.NewDecoder(r)
+		current   URL
+		published time.Time
+		inEntry   = false
+	)
+
+	for {
+		t, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+		}
+
+		switch elem := t.(type) {
+		case xml.StartElement:
+			if !inEntry {
+				if elem.Name.Local == "entry" {
+					inEntry = true
+					current = URL{
+						Priority: DefaultPriority,
+					}
+					published = time.Time{}
+				}
+
+				continue
+			}
+
+			switch elem.Name.Local {
+			case "link":
+				if current.Loc != "" {
+					continue
+				}
+
+				if href, ok := alternateLink(elem); ok {
+					current.Loc = href
+				}
+			case "updated", "published":
+				var value string
+
+				if err := decoder.DecodeElement(&value, &elem); err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+				}
+
+				if elem.Name.Local == "updated" {
+					current.LastMod = ParseLastMod(value)
+				} else {
+					published = ParseLastMod(value)
+				}
+			}
+		case xml.EndElement:
+			if elem.Name.Local == "entry" && inEntry {
+				if current.LastMod.IsZero() {
+					current.LastMod = published
+				}
+
+				if current.Loc != "" {
+					if err := fn(current); err != nil {
+						return nil, fmt.Errorf("%w", err)
+					}
+				}
+
+				inEntry = false
+			}
+		}
+	}
+
+	return &Document{}, nil
+}
+
+// parsePubDate parses the publication date of an RSS item. It returns the
+// zero time if the date cannot be parsed.
+func parsePubDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// alternateLink returns the href of an Atom link element if it points to the
+// alternate version of an entry, which is the entry's web page.
+func alternateLink(elem xml.StartElement) (string, bool) {
+	var href, rel string
+
+	for _, attr := range elem.Attr {
+		switch attr.Name.Local {
+		case "href":
+			href = strings.TrimSpace(attr.Value)
+		case "rel":
+			rel = attr.Value
+		}
+	}
+
+	if href == "" || (rel != "" && rel != "alternate") {
+		return "", false
+	}
+
+	return href, true
+}
@@ -0,0 +1,76 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+// ErrTooLarge is returned when the uncompressed sitemap exceeds the maximum
+// allowed size.
+const ErrTooLarge xerrors.Error = "sitemap exceeds maximum uncompressed size"
+
+// DefaultMaxSize is the default maximum uncompressed size of a sitemap, in
+// bytes. It matches the limit set by the sitemaps protocol.
+const DefaultMaxSize int64 = 50 * 1024 * 1024
+
+// gzipMagic is the magic number at the start of every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b} //nolint:gochecknoglobals // Byte slices cannot be constants.
+
+// NewReader returns a reader over the uncompressed contents of a sitemap.
+//
+// Gzip-compressed data is detected from its magic bytes, or assumed if gzipped
+// is true, and decompressed transparently. Reading more than maxSize bytes of
+// decompressed data returns ErrTooLarge, so a compression bomb can't exhaust
+// memory.
+func NewReader(r io.Reader, gzipped bool, maxSize int64) (io.Reader, error) {
+	bufferedReader := bufio.NewReader(r)
+
+	magic, err := bufferedReader.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF { //nolint:errorlint // Peek returns io.EOF unwrapped.
+		return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+	}
+
+	if !gzipped && !bytes.Equal(magic, gzipMagic) {
+		return bufferedReader, nil
+	}
+
+	gzipReader, err := gzip.NewReader(bufferedReader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+	}
+
+	return bufio.NewReader(&limitedReader{r: gzipReader, n: maxSize}), nil
+}
+
+// limitedReader reads from r and fails with ErrTooLarge once more than n bytes
+// have been read. Unlike io.LimitedReader, it doesn't silently truncate the
+// data, which would otherwise look like a malformed sitemap.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements the io.Reader interface.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrTooLarge
+	}
+
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+
+	if l.n < 0 {
+		return n, ErrTooLarge
+	}
+
+	return n, err //nolint:wrapcheck // Must return io.EOF unwrapped.
+}
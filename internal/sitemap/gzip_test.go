@@ -0,0 +1,87 @@
+package sitemap_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestNewReader(t *testing.T) {
+	t.Parallel()
+
+	const data = "<urlset></urlset>"
+
+	var compressed bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, _ = gzipWriter.Write([]byte(data))
+	_ = gzipWriter.Close()
+
+	tests := []struct {
+		name    string
+		input   []byte
+		gzipped bool
+		maxSize int64
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "plain data",
+			input:   []byte(data),
+			maxSize: 1,
+			want:    data,
+		},
+		{
+			name:    "gzip data detected from magic bytes",
+			input:   compressed.Bytes(),
+			maxSize: sitemap.DefaultMaxSize,
+			want:    data,
+		},
+		{
+			name:    "gzip data announced by caller",
+			input:   compressed.Bytes(),
+			gzipped: true,
+			maxSize: sitemap.DefaultMaxSize,
+			want:    data,
+		},
+		{
+			name:    "gzip data exceeding maximum size",
+			input:   compressed.Bytes(),
+			maxSize: int64(len(data) - 1),
+			wantErr: sitemap.ErrTooLarge,
+		},
+		{
+			name:    "plain data announced as gzip",
+			input:   []byte(data),
+			gzipped: true,
+			maxSize: sitemap.DefaultMaxSize,
+			wantErr: sitemap.ErrSitemap,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := sitemap.NewReader(bytes.NewReader(tt.input), tt.gzipped, tt.maxSize)
+			if err == nil {
+				var got []byte
+
+				got, err = io.ReadAll(r)
+				if err == nil && string(got) != tt.want {
+					t.Errorf("NewReader() got = %q, want %q", got, tt.want)
+				}
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
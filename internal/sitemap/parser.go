@@ -0,0 +1,209 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+// ErrUnknownFormat is returned when a URL source format isn't supported or
+// can't be detected.
+const ErrUnknownFormat xerrors.Error = "unknown sitemap format"
+
+// sniffSize is the number of bytes AutoParser inspects to detect the format of
+// a URL source.
+const sniffSize = 4096
+
+// Format identifies the format of a URL source.
+type Format string
+
+// Supported URL source formats.
+const (
+	// FormatAuto detects the format from the document itself.
+	FormatAuto Format = "auto"
+
+	// FormatXML is an XML sitemap or sitemap index.
+	FormatXML Format = "xml"
+
+	// FormatText is a plain text file with one URL per line.
+	FormatText Format = "text"
+
+	// FormatRSS is an RSS 2.0 feed.
+	FormatRSS Format = "rss"
+
+	// FormatAtom is an Atom feed.
+	FormatAtom Format = "atom"
+)
+
+// WalkFunc is called for every page URL found while walking a URL source. If
+// it returns an error, the walk stops and returns that error.
+type WalkFunc func(u URL) error
+
+// Parser parses a URL source into a Document.
+type Parser interface {
+	// Parse reads a URL source from an io.Reader and returns the URLs it
+	// lists.
+	Parse(r io.Reader) (*Document, error)
+
+	// Walk reads a URL source from an io.Reader and calls fn for every page
+	// URL it lists, as soon as it's parsed, without keeping them in memory.
+	// The returned Document has no URLs, but lists the child sitemaps of a
+	// sitemap index.
+	//
+	// Both methods may return a Document along with a ValidationError, when
+	// a strict parser could read the whole document but found parts of it
+	// that don't follow the sitemaps protocol.
+	Walk(r io.Reader, fn WalkFunc) (*Document, error)
+}
+
+// collect parses a URL source with walk and returns every URL it lists in a
+// Document. If walk returns a Document along with an error, both are returned.
+func collect(r io.Reader, walk func(io.Reader, WalkFunc) (*Document, error)) (*Document, error) {
+	urls := make([]URL, 0, AverageSitemapSize)
+
+	doc, err := walk(r, func(u URL) error {
+		urls = append(urls, u)
+
+		return nil
+	})
+	if doc != nil {
+		doc.URLs = urls
+	}
+
+	return doc, err
+}
+
+// ParserFor returns the Parser for the given format, or ErrUnknownFormat if
+// the format isn't supported. An empty format is the same as FormatAuto. If
+// strict is true, XML sitemaps are validated against the sitemaps protocol, as
+// documented in XMLParser; it has no effect on other formats.
+func ParserFor(format Format, strict bool) (Parser, error) {
+	switch format {
+	case FormatAuto, "":
+		return AutoParser{Strict: strict}, nil
+	case FormatXML:
+		return XMLParser{Strict: strict}, nil
+	case FormatText:
+		return TextParser{}, nil
+	case FormatRSS:
+		return RSSParser{}, nil
+	case FormatAtom:
+		return AtomParser{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// AutoParser detects the format of a URL source and parses it with the
+// matching Parser.
+type AutoParser struct {
+	// Strict enables strict mode for XML sitemaps, as documented in
+	// XMLParser.
+	Strict bool
+}
+
+// Parse implements the Parser interface.
+func (p AutoParser) Parse(r io.Reader) (*Document, error) {
+	parser, bufferedReader, err := detectParser(r, p.Strict)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.Parse(bufferedReader) //nolint:wrapcheck // Errors from parsers are already wrapped.
+}
+
+// Walk implements the Parser interface.
+func (p AutoParser) Walk(r io.Reader, fn WalkFunc) (*Document, error) {
+	parser, bufferedReader, err := detectParser(r, p.Strict)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.Walk(bufferedReader, fn) //nolint:wrapcheck // Errors from parsers are already wrapped.
+}
+
+// detectParser detects the format of a URL source and returns the matching
+// Parser, along with a reader that still returns the bytes inspected.
+func detectParser(r io.Reader, strict bool) (Parser, io.Reader, error) {
+	bufferedReader := bufio.NewReaderSize(r, sniffSize)
+
+	head, err := bufferedReader.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+	}
+
+	format := Detect(head)
+	if format == "" {
+		return nil, nil, fmt.Errorf("%w: %w", ErrSitemap, ErrUnknownFormat)
+	}
+
+	parser, err := ParserFor(format, strict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return parser, bufferedReader, nil
+}
+
+// Detect guesses the format of a URL source from its first bytes. Documents
+// that don't look like XML are assumed to be plain text, and an empty Format
+// is returned for XML documents of an unknown type.
+func Detect(head []byte) Format {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	if !bytes.HasPrefix(trimmed, []byte("<")) {
+		return FormatText
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+
+		elem, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch elem.Name.Local {
+		case "urlset", "sitemapindex":
+			return FormatXML
+		case "rss", "RDF":
+			return FormatRSS
+		case "feed":
+			return FormatAtom
+		default:
+			return ""
+		}
+	}
+}
+
+// XMLParser parses XML sitemaps and sitemap indexes.
+//
+// By default, XMLParser is lenient: elements of the sitemaps protocol are
+// accepted with or without a namespace, and elements it doesn't expect are
+// ignored. In strict mode, documents must follow the sitemaps protocol, and a
+// ValidationError listing every violation found, along with its line number,
+// is returned otherwise, together with the parsed Document.
+type XMLParser struct {
+	// Strict enables strict mode.
+	Strict bool
+}
+
+// Parse implements the Parser interface.
+func (p XMLParser) Parse(r io.Reader) (*Document, error) {
+	return collect(r, p.Walk)
+}
+
+// Walk implements the Parser interface.
+func (p XMLParser) Walk(r io.Reader, fn WalkFunc) (*Document, error) {
+	return walkXML(r, fn, p.Strict)
+}
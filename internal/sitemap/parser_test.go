@@ -0,0 +1,162 @@
+package sitemap_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestParserFor(t *testing.T) {
+	t.Parallel()
+
+	want := []string{
+		"http://example.com/page1",
+		"http://example.com/page2",
+	}
+
+	tests := []struct {
+		name     string
+		format   sitemap.Format
+		fileName string
+		want     []string
+		wantErr  error
+		strict   bool
+	}{
+		{
+			name:     "xml sitemap",
+			format:   sitemap.FormatXML,
+			fileName: "valid-sitemap.xml",
+			want:     want,
+		},
+		{
+			name:     "text sitemap",
+			format:   sitemap.FormatText,
+			fileName: "text-sitemap.txt",
+			want:     want,
+		},
+		{
+			name:     "rss feed",
+			format:   sitemap.FormatRSS,
+			fileName: "rss-feed.xml",
+			want:     want,
+		},
+		{
+			name:     "atom feed",
+			format:   sitemap.FormatAtom,
+			fileName: "atom-feed.xml",
+			want:     want,
+		},
+		{
+			name:     "auto-detected xml sitemap",
+			format:   sitemap.FormatAuto,
+			fileName: "valid-sitemap.xml",
+			want:     want,
+		},
+		{
+			name:     "strict xml sitemap",
+			format:   sitemap.FormatXML,
+			fileName: "valid-sitemap.xml",
+			want:     want,
+			strict:   true,
+		},
+		{
+			name:     "strict auto-detected rss feed",
+			format:   sitemap.FormatAuto,
+			fileName: "rss-feed.xml",
+			want:     want,
+			strict:   true,
+		},
+		{
+			name:     "auto-detected text sitemap",
+			format:   sitemap.FormatAuto,
+			fileName: "text-sitemap.txt",
+			want:     want,
+		},
+		{
+			name:     "auto-detected rss feed",
+			format:   sitemap.FormatAuto,
+			fileName: "rss-feed.xml",
+			want:     want,
+		},
+		{
+			name:     "auto-detected atom feed",
+			format:   sitemap.FormatAuto,
+			fileName: "atom-feed.xml",
+			want:     want,
+		},
+		{
+			name:    "unknown format",
+			format:  sitemap.Format("json"),
+			wantErr: sitemap.ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parser, err := sitemap.ParserFor(tt.format, tt.strict)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParserFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			file, err := os.Open("testdata/" + tt.fileName)
+			if err != nil {
+				t.Fatalf("could not open test file: %v", err)
+			}
+			defer file.Close()
+
+			got, err := parser.Parse(file)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if locs := sitemap.Locs(got.URLs); !reflect.DeepEqual(locs, tt.want) {
+				t.Errorf("Parse() got = %v, want %v", locs, tt.want)
+			}
+
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				t.Fatalf("could not rewind test file: %v", err)
+			}
+
+			walked := make([]string, 0, len(tt.want))
+
+			doc, err := parser.Walk(file, func(u sitemap.URL) error {
+				walked = append(walked, u.Loc)
+
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+
+			if len(doc.URLs) != 0 {
+				t.Errorf("Walk() returned %d URLs in the document, want none", len(doc.URLs))
+			}
+
+			if !reflect.DeepEqual(walked, tt.want) {
+				t.Errorf("Walk() got = %v, want %v", walked, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoParser_ParseUnknown(t *testing.T) {
+	t.Parallel()
+
+	_, err := sitemap.AutoParser{}.Parse(strings.NewReader(`<?xml version="1.0"?><html></html>`))
+	if !errors.Is(err, sitemap.ErrUnknownFormat) {
+		t.Errorf("Parse() error = %v, wantErr %v", err, sitemap.ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,60 @@
+package sitemap
+
+import "math/rand"
+
+// Reservoir keeps a uniformly random sample of a fixed number of URLs from a
+// stream of unknown length, such as the URLs passed to a WalkFunc, using
+// reservoir sampling. Memory use depends only on the size of the sample, no
+// matter how many URLs are added.
+type Reservoir struct {
+	// urls is the current sample.
+	urls []URL
+
+	// size is the maximum number of URLs in the sample.
+	size int
+
+	// seen is the number of URLs added so far.
+	seen int
+}
+
+// NewReservoir returns a new Reservoir keeping up to size URLs. A size less
+// than one is treated as one.
+func NewReservoir(size int) *Reservoir {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Reservoir{
+		urls: make([]URL, 0, min(size, AverageSitemapSize)),
+		size: size,
+	}
+}
+
+// Add offers a URL to the sample. Every URL added so far has the same chance
+// of being in the sample. It always returns nil, so it can be used as a
+// WalkFunc.
+func (r *Reservoir) Add(u URL) error {
+	r.seen++
+
+	if len(r.urls) < r.size {
+		r.urls = append(r.urls, u)
+
+		return nil
+	}
+
+	if i := rand.Intn(r.seen); i < r.size { //nolint:gosec // we don't need cryptographic randomness here
+		r.urls[i] = u
+	}
+
+	return nil
+}
+
+// URLs returns the sampled URLs, in no particular order.
+func (r *Reservoir) URLs() []URL {
+	return r.urls
+}
+
+// Seen returns the number of URLs added to the reservoir.
+func (r *Reservoir) Seen() int {
+	return r.seen
+}
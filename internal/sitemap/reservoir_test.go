@@ -0,0 +1,105 @@
+package sitemap_test
+
+import (
+	"strconv"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestReservoir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  int
+	}{
+		{
+			name:  "fewer URLs than the sample size",
+			size:  10,
+			added: 3,
+			want:  3,
+		},
+		{
+			name:  "more URLs than the sample size",
+			size:  10,
+			added: 1000,
+			want:  10,
+		},
+		{
+			name:  "invalid sample size",
+			size:  0,
+			added: 5,
+			want:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reservoir := sitemap.NewReservoir(tt.size)
+
+			for i := 0; i < tt.added; i++ {
+				if err := reservoir.Add(sitemap.URL{Loc: strconv.Itoa(i)}); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+
+			if got := len(reservoir.URLs()); got != tt.want {
+				t.Errorf("URLs() got %d URLs, want %d", got, tt.want)
+			}
+
+			if got := reservoir.Seen(); got != tt.added {
+				t.Errorf("Seen() = %d, want %d", got, tt.added)
+			}
+
+			seen := make(map[string]struct{}, tt.want)
+
+			for _, u := range reservoir.URLs() {
+				if _, ok := seen[u.Loc]; ok {
+					t.Errorf("URLs() returned %q more than once", u.Loc)
+				}
+
+				seen[u.Loc] = struct{}{}
+			}
+		})
+	}
+}
+
+func TestReservoir_Uniform(t *testing.T) {
+	t.Parallel()
+
+	const (
+		urls   = 10
+		rounds = 10000
+	)
+
+	counts := make(map[string]int, urls)
+
+	for i := 0; i < rounds; i++ {
+		reservoir := sitemap.NewReservoir(1)
+
+		for j := 0; j < urls; j++ {
+			_ = reservoir.Add(sitemap.URL{Loc: strconv.Itoa(j)})
+		}
+
+		counts[reservoir.URLs()[0].Loc]++
+	}
+
+	// Every URL should be picked about rounds/urls times; allow a generous
+	// margin so the test isn't flaky.
+	for loc, count := range counts {
+		if count < rounds/urls/2 || count > rounds/urls*2 {
+			t.Errorf("URL %s picked %d times out of %d, want about %d", loc, count, rounds, rounds/urls)
+		}
+	}
+
+	if len(counts) != urls {
+		t.Errorf("%d distinct URLs picked, want %d", len(counts), urls)
+	}
+}
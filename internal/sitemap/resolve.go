@@ -0,0 +1,392 @@
+package sitemap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+	"git.sr.ht/~jamesponddotco/xstd-go/xnet/xhttp"
+)
+
+const (
+	// ErrMaxDepth is returned, wrapped in ErrSitemap, when a sitemap index
+	// nests deeper than allowed.
+	ErrMaxDepth xerrors.Error = "sitemap index exceeds maximum depth"
+
+	// ErrChildSitemaps is returned when every child sitemap of a sitemap
+	// index fails to load.
+	ErrChildSitemaps xerrors.Error = "every child sitemap failed to load"
+)
+
+// DefaultMaxDepth is the default number of nested sitemap indexes a Resolver
+// follows. The sitemaps protocol doesn't allow nesting indexes, but some
+// generators do it anyway.
+const DefaultMaxDepth = 3
+
+// Resolver fetches a sitemap and, if it's a sitemap index, recursively fetches
+// and merges its child sitemaps.
+type Resolver struct {
+	// fetchClient is the client used to download sitemaps.
+	fetchClient *fetch.Client
+
+	// parser is the Parser used to parse every downloaded document.
+	parser Parser
+
+	// documents holds the last decoded version of every sitemap fetched, so
+	// unchanged sitemaps don't have to be downloaded again.
+	documents map[string]*cachedDocument
+
+	// maxDepth is the maximum number of nested sitemap indexes to follow.
+	maxDepth int
+
+	// mu serializes calls to Resolve and protects documents.
+	mu sync.Mutex
+}
+
+// NewResolver returns a new Resolver that parses documents with parser and
+// follows up to maxDepth nested sitemap indexes. If parser is nil, AutoParser
+// is used, and if maxDepth is less than one, DefaultMaxDepth is used.
+func NewResolver(fetchClient *fetch.Client, parser Parser, maxDepth int) *Resolver {
+	if parser == nil {
+		parser = AutoParser{}
+	}
+
+	if maxDepth < 1 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	return &Resolver{
+		fetchClient: fetchClient,
+		parser:      parser,
+		documents:   make(map[string]*cachedDocument),
+		maxDepth:    maxDepth,
+	}
+}
+
+// cachedDocument is a decoded sitemap kept by a Resolver, along with the
+// validators of the response it was decoded from. The two are kept together,
+// so a conditional request is only ever made for a document the Resolver has.
+type cachedDocument struct {
+	// doc is the decoded document.
+	doc *Document
+
+	// validator holds the cache validators of the response.
+	validator fetch.Validator
+}
+
+// Visit describes a sitemap document a Resolver downloaded, or tried to.
+type Visit struct {
+	// Document is the parsed document, or nil if it couldn't be downloaded
+	// or parsed.
+	Document *Document
+
+	// Err is why the document couldn't be loaded, if any.
+	Err error
+
+	// URL is the URL of the document.
+	URL string
+
+	// Parent is the URL of the sitemap index listing the document, or empty
+	// for the sitemap a traversal starts from.
+	Parent string
+
+	// Depth is the number of sitemap indexes above the document.
+	Depth int
+}
+
+// VisitFunc is called for every sitemap document a Resolver downloads or
+// fails to download, before the children of a sitemap index are followed.
+//
+// If the returned error isn't nil, the document is considered failed and its
+// children aren't followed. Returning v.Err, which is what a nil VisitFunc
+// does, fails the documents that couldn't be loaded.
+type VisitFunc func(v *Visit) error
+
+// traversal holds the state of a single Resolve or Walk call.
+type traversal struct {
+	// load downloads and parses a single document.
+	load func(ctx context.Context, uri string) (*Document, error)
+
+	// visit is called for every document.
+	visit VisitFunc
+
+	// visited is the set of documents already loaded.
+	visited map[string]struct{}
+
+	// stop is the error that stops the traversal altogether, such as an
+	// error returned by a WalkFunc.
+	stop error
+}
+
+// Resolve fetches the sitemap at uri and returns the URLs it lists. Sitemap
+// indexes are followed recursively, each child sitemap is fetched at most once,
+// and the URLs from all children are merged in document order.
+//
+// Child sitemaps that fail to load are skipped, and Resolve only fails if the
+// sitemap at uri fails to load, or if every child of a sitemap index does.
+// visit, which may be nil, is called for every document, and can be used to
+// log the children that were skipped.
+//
+// Sitemaps the server reports as not modified since the previous call are
+// served from memory.
+func (r *Resolver) Resolve(ctx context.Context, uri string, visit VisitFunc) ([]URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		urls = make([]URL, 0, AverageSitemapSize)
+		t    = &traversal{
+			load:    r.fetch,
+			visit:   visit,
+			visited: make(map[string]struct{}),
+		}
+	)
+
+	if t.visit == nil {
+		t.visit = failVisit
+	}
+
+	collect := t.visit
+	t.visit = func(v *Visit) error {
+		if err := collect(v); err != nil {
+			return err
+		}
+
+		if v.Document != nil && !v.Document.IsIndex() {
+			urls = append(urls, v.Document.URLs...)
+		}
+
+		return nil
+	}
+
+	if err := r.traverse(ctx, t, uri, "", 0); err != nil {
+		return nil, err
+	}
+
+	// Drop sitemaps that are no longer referenced.
+	for key := range r.documents {
+		if _, ok := t.visited[key]; !ok {
+			delete(r.documents, key)
+		}
+	}
+
+	return urls, nil
+}
+
+// Walk fetches the sitemap at uri and calls fn for every URL it lists, as soon
+// as it's parsed. Sitemap indexes are followed recursively and failing child
+// sitemaps are skipped like in Resolve, but neither URLs nor documents are
+// kept in memory, so huge sitemaps can be processed with bounded memory. URLs
+// from a child sitemap that fails halfway through are still passed to fn.
+//
+// As documents aren't kept, every sitemap is downloaded again on each call.
+func (r *Resolver) Walk(ctx context.Context, uri string, fn WalkFunc, visit VisitFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := &traversal{
+		visit:   visit,
+		visited: make(map[string]struct{}),
+	}
+
+	if t.visit == nil {
+		t.visit = failVisit
+	}
+
+	t.load = func(ctx context.Context, uri string) (*Document, error) {
+		return r.walkDocument(ctx, uri, func(u URL) error {
+			if err := fn(u); err != nil {
+				t.stop = err
+
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	return r.traverse(ctx, t, uri, "", 0)
+}
+
+// failVisit is the VisitFunc used when none is given, which fails the
+// documents that couldn't be loaded.
+func failVisit(v *Visit) error {
+	return v.Err
+}
+
+// traverse loads a single sitemap and descends into its children if it's an
+// index, skipping the children that fail to load.
+func (r *Resolver) traverse(ctx context.Context, t *traversal, uri, parent string, depth int) error {
+	if _, ok := t.visited[uri]; ok {
+		return nil
+	}
+
+	t.visited[uri] = struct{}{}
+
+	doc, err := t.load(ctx, uri)
+	if t.stop != nil {
+		return t.stop
+	}
+
+	if err == nil && doc.IsIndex() && depth >= r.maxDepth {
+		err = fmt.Errorf("%w: %w: %s", ErrSitemap, ErrMaxDepth, uri)
+	}
+
+	visit := &Visit{
+		Document: doc,
+		Err:      err,
+		URL:      uri,
+		Parent:   parent,
+		Depth:    depth,
+	}
+
+	if err = t.visit(visit); err != nil {
+		return err
+	}
+
+	if doc == nil || !doc.IsIndex() || depth >= r.maxDepth {
+		return nil
+	}
+
+	var failed []error
+
+	for _, child := range doc.Sitemaps {
+		err := r.traverse(ctx, t, child, uri, depth+1)
+		if t.stop != nil {
+			return t.stop
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%w", ctxErr)
+		}
+
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(doc.Sitemaps) > 0 && len(failed) == len(doc.Sitemaps) {
+		return fmt.Errorf("%w: %s: %w", ErrChildSitemaps, uri, errors.Join(failed...))
+	}
+
+	return nil
+}
+
+// walkDocument downloads a single sitemap document and calls fn for its URLs.
+func (r *Resolver) walkDocument(ctx context.Context, uri string, fn WalkFunc) (*Document, error) {
+	resp, err := r.fetchClient.Remote(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := NewReader(&limitedReader{r: resp.Body, n: DefaultMaxSize}, isGzip(resp), DefaultMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, uri)
+	}
+
+	counter := &countingReader{r: body}
+
+	doc, err := r.parser.Walk(counter, fn)
+	if doc != nil {
+		doc.size = counter.n
+	}
+
+	if err != nil {
+		return doc, fmt.Errorf("%w: %s", err, uri)
+	}
+
+	return doc, nil
+}
+
+// fetch downloads and decodes a single sitemap document, reusing the previous
+// version if it hasn't changed.
+func (r *Resolver) fetch(ctx context.Context, uri string) (*Document, error) {
+	var validator fetch.Validator
+
+	cached, ok := r.documents[uri]
+	if ok {
+		validator = cached.validator
+	}
+
+	resp, err := r.fetchClient.RemoteIfModified(ctx, uri, validator)
+	if errors.Is(err, fetch.ErrNotModified) {
+		return cached.doc, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer resp.Body.Close()
+
+	doc, err := r.parse(resp)
+	if err != nil {
+		// Make the next request unconditional, so the server doesn't report
+		// the document as not modified when there's no copy of it.
+		delete(r.documents, uri)
+
+		return doc, fmt.Errorf("%w: %s", err, uri)
+	}
+
+	r.documents[uri] = &cachedDocument{
+		doc:       doc,
+		validator: fetch.ValidatorOf(resp),
+	}
+
+	return doc, nil
+}
+
+// parse decompresses and parses a sitemap response.
+func (r *Resolver) parse(resp *http.Response) (*Document, error) {
+	// Limit the body as well as the decompressed data, as the HTTP client
+	// transparently decompresses responses it asked to be compressed.
+	body, err := NewReader(&limitedReader{r: resp.Body, n: DefaultMaxSize}, isGzip(resp), DefaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &countingReader{r: body}
+
+	doc, err := r.parser.Parse(counter)
+	if doc != nil {
+		doc.size = counter.n
+	}
+
+	return doc, err //nolint:wrapcheck // Errors from parsers are already wrapped.
+}
+
+// isGzip reports whether the response headers announce a gzip-compressed
+// body that the HTTP client didn't already decompress.
+func isGzip(resp *http.Response) bool {
+	if strings.EqualFold(resp.Header.Get(xhttp.ContentEncoding), xhttp.Gzip) && !resp.Uncompressed {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get(xhttp.ContentType))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/gzip" || mediaType == "application/x-gzip"
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements the io.Reader interface.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err //nolint:wrapcheck // Must return io.EOF unwrapped.
+}
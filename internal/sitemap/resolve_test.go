@@ -0,0 +1,394 @@
+package sitemap_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/fetch"
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+// testRateLimit is high enough for tests downloading several sitemaps not to
+// wait on the rate limit of the client.
+const testRateLimit = 1000
+
+const (
+	testIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+%s
+</sitemapindex>`
+
+	testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+%s
+</urlset>`
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf(
+				"<sitemap><loc>%[1]s/post-sitemap.xml</loc></sitemap>"+
+					"<sitemap><loc>%[1]s/page-sitemap.xml</loc></sitemap>"+
+					"<sitemap><loc>%[1]s/sitemap_index.xml</loc></sitemap>",
+				srv.URL,
+			))
+		case "/post-sitemap.xml":
+			fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/post1</loc></url>"+
+				"<url><loc>http://example.com/post2</loc></url>")
+		case "/page-sitemap.xml":
+			fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/page1</loc></url>")
+		case "/nested_index.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf(
+				"<sitemap><loc>%s/sitemap_index.xml</loc></sitemap>",
+				srv.URL,
+			))
+		case "/partial_index.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf(
+				"<sitemap><loc>%[1]s/missing.xml</loc></sitemap>"+
+					"<sitemap><loc>%[1]s/page-sitemap.xml</loc></sitemap>",
+				srv.URL,
+			))
+		case "/broken_index.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf(
+				"<sitemap><loc>%[1]s/missing.xml</loc></sitemap>"+
+					"<sitemap><loc>%[1]s/gone.xml</loc></sitemap>",
+				srv.URL,
+			))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := fetch.New("TestService", "test@example.com", testRateLimit)
+
+	tests := []struct {
+		name     string
+		path     string
+		maxDepth int
+		want     []string
+		wantErr  error
+	}{
+		{
+			name:     "regular sitemap",
+			path:     "/page-sitemap.xml",
+			maxDepth: 1,
+			want:     []string{"http://example.com/page1"},
+		},
+		{
+			name:     "sitemap index with cycle",
+			path:     "/sitemap_index.xml",
+			maxDepth: 1,
+			want: []string{
+				"http://example.com/post1",
+				"http://example.com/post2",
+				"http://example.com/page1",
+			},
+		},
+		{
+			name:     "nested index within depth",
+			path:     "/nested_index.xml",
+			maxDepth: 2,
+			want: []string{
+				"http://example.com/post1",
+				"http://example.com/post2",
+				"http://example.com/page1",
+			},
+		},
+		{
+			name:     "nested index beyond depth",
+			path:     "/nested_index.xml",
+			maxDepth: 1,
+			wantErr:  sitemap.ErrMaxDepth,
+		},
+		{
+			name:     "missing sitemap",
+			path:     "/missing.xml",
+			maxDepth: 1,
+			wantErr:  fetch.ErrFetchData,
+		},
+		{
+			name:     "missing child sitemap",
+			path:     "/partial_index.xml",
+			maxDepth: 1,
+			want:     []string{"http://example.com/page1"},
+		},
+		{
+			name:     "every child sitemap missing",
+			path:     "/broken_index.xml",
+			maxDepth: 1,
+			wantErr:  sitemap.ErrChildSitemaps,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resolver := sitemap.NewResolver(client, nil, tt.maxDepth)
+
+			got, err := resolver.Resolve(context.Background(), srv.URL+tt.path, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if locs := sitemap.Locs(got); !reflect.DeepEqual(locs, tt.want) {
+				t.Errorf("Resolve() got = %v, want %v", locs, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_ResolveNotModified(t *testing.T) {
+	t.Parallel()
+
+	var downloads atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		downloads.Add(1)
+
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/page1</loc></url>")
+	}))
+	t.Cleanup(srv.Close)
+
+	resolver := sitemap.NewResolver(fetch.New("TestService", "test@example.com", testRateLimit), nil, 1)
+
+	for i := 0; i < 3; i++ {
+		got, err := resolver.Resolve(context.Background(), srv.URL, nil)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+
+		if want := []string{"http://example.com/page1"}; !reflect.DeepEqual(sitemap.Locs(got), want) {
+			t.Errorf("Resolve() got = %v, want %v", sitemap.Locs(got), want)
+		}
+	}
+
+	if got := downloads.Load(); got != 1 {
+		t.Errorf("sitemap downloaded %d times, want 1", got)
+	}
+}
+
+func TestResolver_ResolveSharedClient(t *testing.T) {
+	t.Parallel()
+
+	const etag = `"v1"`
+
+	var (
+		srv                     *httptest.Server
+		downloads, conditionals atomic.Int32
+	)
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.xml", "/b.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf("<sitemap><loc>%s/shared.xml</loc></sitemap>", srv.URL))
+		case "/shared.xml":
+			if r.Header.Get("If-None-Match") != "" {
+				conditionals.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+
+			downloads.Add(1)
+
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/page1</loc></url>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// Two sites sharing a client and a child sitemap must not answer each
+	// other's conditional requests.
+	var (
+		client    = fetch.New("TestService", "test@example.com", testRateLimit)
+		resolvers = map[string]*sitemap.Resolver{
+			"/a.xml": sitemap.NewResolver(client, nil, 0),
+			"/b.xml": sitemap.NewResolver(client, nil, 0),
+		}
+	)
+
+	for i := 0; i < 2; i++ {
+		for path, resolver := range resolvers {
+			got, err := resolver.Resolve(context.Background(), srv.URL+path, nil)
+			if err != nil {
+				t.Fatalf("Resolve(%s) error = %v", path, err)
+			}
+
+			if want := []string{"http://example.com/page1"}; !reflect.DeepEqual(sitemap.Locs(got), want) {
+				t.Errorf("Resolve(%s) got = %v, want %v", path, sitemap.Locs(got), want)
+			}
+		}
+	}
+
+	if got := downloads.Load(); got != 2 {
+		t.Errorf("shared sitemap downloaded %d times, want 2", got)
+	}
+
+	if got := conditionals.Load(); got != 2 {
+		t.Errorf("shared sitemap requested conditionally %d times, want 2", got)
+	}
+}
+
+func TestResolver_ResolveVisit(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf(
+				"<sitemap><loc>%[1]s/missing.xml</loc></sitemap>"+
+					"<sitemap><loc>%[1]s/page-sitemap.xml</loc></sitemap>",
+				srv.URL,
+			))
+		case "/page-sitemap.xml":
+			fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/page1</loc></url>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		resolver = sitemap.NewResolver(fetch.New("TestService", "test@example.com", testRateLimit), nil, 1)
+		visited  []string
+		skipped  []string
+	)
+
+	got, err := resolver.Resolve(context.Background(), srv.URL+"/sitemap_index.xml", func(v *sitemap.Visit) error {
+		visited = append(visited, v.URL)
+
+		if v.Err != nil {
+			if v.Parent != srv.URL+"/sitemap_index.xml" || v.Depth != 1 {
+				t.Errorf("Visit = %+v, want child of the index", v)
+			}
+
+			skipped = append(skipped, v.URL)
+		}
+
+		return v.Err
+	})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if want := []string{"http://example.com/page1"}; !reflect.DeepEqual(sitemap.Locs(got), want) {
+		t.Errorf("Resolve() got = %v, want %v", sitemap.Locs(got), want)
+	}
+
+	wantVisited := []string{
+		srv.URL + "/sitemap_index.xml",
+		srv.URL + "/missing.xml",
+		srv.URL + "/page-sitemap.xml",
+	}
+
+	if !reflect.DeepEqual(visited, wantVisited) {
+		t.Errorf("visited = %v, want %v", visited, wantVisited)
+	}
+
+	if want := []string{srv.URL + "/missing.xml"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+}
+
+func TestResolver_Walk(t *testing.T) {
+	t.Parallel()
+
+	var (
+		srv       *httptest.Server
+		downloads atomic.Int32
+	)
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, testIndex, fmt.Sprintf(
+				"<sitemap><loc>%[1]s/post-sitemap.xml</loc></sitemap>"+
+					"<sitemap><loc>%[1]s/page-sitemap.xml</loc></sitemap>",
+				srv.URL,
+			))
+		case "/post-sitemap.xml":
+			fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/post1</loc></url>"+
+				"<url><loc>http://example.com/post2</loc></url>")
+		case "/page-sitemap.xml":
+			fmt.Fprintf(w, testURLSet, "<url><loc>http://example.com/page1</loc></url>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	resolver := sitemap.NewResolver(fetch.New("TestService", "test@example.com", testRateLimit), nil, 1)
+
+	want := []string{
+		"http://example.com/post1",
+		"http://example.com/post2",
+		"http://example.com/page1",
+	}
+
+	// Walk twice to make sure documents are downloaded again even though the
+	// server sent validators.
+	for i := 0; i < 2; i++ {
+		got := make([]string, 0, len(want))
+
+		err := resolver.Walk(context.Background(), srv.URL+"/sitemap_index.xml", func(u sitemap.URL) error {
+			got = append(got, u.Loc)
+
+			return nil
+		}, nil)
+		if err != nil {
+			t.Fatalf("Walk() error = %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Walk() got = %v, want %v", got, want)
+		}
+	}
+
+	if got := downloads.Load(); got != 6 {
+		t.Errorf("sitemaps downloaded %d times, want 6", got)
+	}
+
+	errStop := errors.New("stop")
+
+	err := resolver.Walk(context.Background(), srv.URL+"/sitemap_index.xml", func(sitemap.URL) error {
+		return errStop
+	}, nil)
+	if !errors.Is(err, errStop) {
+		t.Errorf("Walk() error = %v, want %v", err, errStop)
+	}
+}
@@ -3,34 +3,223 @@
 package sitemap
 
 import (
-	"bufio"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
 )
 
-// ErrSitemap is returned when a sitemap cannot be parsed.
-const ErrSitemap xerrors.Error = "failed to parse sitemap"
+const (
+	// ErrSitemap is returned when a sitemap cannot be parsed.
+	ErrSitemap xerrors.Error = "failed to parse sitemap"
+
+	// ErrSitemapIndex is returned by Parse when given a sitemap index instead
+	// of a regular sitemap.
+	ErrSitemapIndex xerrors.Error = "sitemap is a sitemap index"
+)
 
 // AverageSitemapSize is the average size of a sitemap.
 const AverageSitemapSize = 1000
 
+// DefaultPriority is the priority of URLs that don't specify one, as defined
+// by the sitemaps protocol.
+const DefaultPriority = 0.5
+
+// ChangeFreq is how frequently a page is likely to change.
+type ChangeFreq string
+
+// Change frequencies defined by the sitemaps protocol.
+const (
+	ChangeFreqAlways  ChangeFreq = "always"
+	ChangeFreqHourly  ChangeFreq = "hourly"
+	ChangeFreqDaily   ChangeFreq = "daily"
+	ChangeFreqWeekly  ChangeFreq = "weekly"
+	ChangeFreqMonthly ChangeFreq = "monthly"
+	ChangeFreqYearly  ChangeFreq = "yearly"
+	ChangeFreqNever   ChangeFreq = "never"
+)
+
+// lastModLayouts are the W3C Datetime layouts accepted in lastmod elements,
+// from most to least common.
+var lastModLayouts = []string{ //nolint:gochecknoglobals // Slices cannot be constants.
+	time.RFC3339Nano,
+	"2006-01-02",
+	"2006-01-02T15:04Z07:00",
+	"2006-01",
+	"2006",
+}
+
 // URL represents a single URL element in the XML sitemap.
 type URL struct {
-	Loc string `xml:"loc"`
+	// LastMod is the date the page was last modified. It's the zero time if
+	// the sitemap doesn't specify it.
+	LastMod time.Time
+
+	// Loc is the URL of the page.
+	Loc string
+
+	// News is the news article on the page, if any.
+	News *News
+
+	// Images is the list of images on the page.
+	Images []Image
+
+	// Videos is the list of videos on the page.
+	Videos []Video
+
+	// Alternates is the list of localized versions of the page.
+	Alternates []Alternate
+
+	// ChangeFreq is how frequently the page is likely to change. It's empty
+	// if the sitemap doesn't specify it.
+	ChangeFreq ChangeFreq
+
+	// Priority is the priority of the page relative to other pages on the
+	// site, between 0.0 and 1.0. It's DefaultPriority if the sitemap doesn't
+	// specify it.
+	Priority float64
+}
+
+// Locs returns the location of every URL.
+func Locs(urls []URL) []string {
+	locs := make([]string, 0, len(urls))
+
+	for _, u := range urls {
+		locs = append(locs, u.Loc)
+	}
+
+	return locs
+}
+
+// ParseLastMod parses a date in one of the W3C Datetime formats used by
+// sitemaps and feeds. It returns the zero time if the date cannot be parsed.
+func ParseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// parsePriority parses the priority of a URL, returning DefaultPriority if
+// it's missing or out of range.
+func parsePriority(value string) float64 {
+	priority, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || priority < 0 || priority > 1 {
+		return DefaultPriority
+	}
+
+	return priority
+}
+
+// Document represents a parsed sitemap document, which is either a regular
+// sitemap listing page URLs or a sitemap index listing other sitemaps.
+type Document struct {
+	// URLs is the list of page URLs found in a regular sitemap.
+	URLs []URL
+
+	// Sitemaps is the list of child sitemap URLs found in a sitemap index.
+	Sitemaps []string
+
+	// index reports whether the root element is a sitemap index.
+	index bool
+
+	// size is the uncompressed size of the document, in bytes.
+	size int64
+}
+
+// IsIndex reports whether the document is a sitemap index.
+func (d *Document) IsIndex() bool {
+	return d.index
+}
+
+// Size returns the uncompressed size of the document in bytes, if it was
+// downloaded by a Resolver, or zero otherwise.
+func (d *Document) Size() int64 {
+	return d.size
 }
 
 // Parse reads a sitemap from an io.Reader an returns a slice of URLs.
-func Parse(r io.Reader) ([]string, error) {
+//
+// Parse returns ErrSitemapIndex if the document is a sitemap index; use Decode
+// or a Resolver to handle those.
+func Parse(r io.Reader) ([]URL, error) {
+	doc, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.IsIndex() {
+		return nil, fmt.Errorf("%w: %w", ErrSitemap, ErrSitemapIndex)
+	}
+
+	return doc.URLs, nil
+}
+
+// Decode reads an XML sitemap or sitemap index from an io.Reader and returns
+// the URLs it lists. Gzip-compressed documents are decompressed transparently.
+func Decode(r io.Reader) (*Document, error) {
+	body, err := NewReader(r, false, DefaultMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeXML(body)
+}
+
+// Walk reads a sitemap from an io.Reader and calls fn for every URL it lists,
+// as soon as it's parsed, so the sitemap never has to fit in memory.
+// Gzip-compressed documents are decompressed transparently.
+//
+// Walk returns ErrSitemapIndex if the document is a sitemap index; use a
+// Resolver to walk those.
+func Walk(r io.Reader, fn WalkFunc) error {
+	body, err := NewReader(r, false, DefaultMaxSize)
+	if err != nil {
+		return err
+	}
+
+	doc, err := walkXML(body, fn, false)
+	if err != nil {
+		return err
+	}
+
+	if doc.IsIndex() {
+		return fmt.Errorf("%w: %w", ErrSitemap, ErrSitemapIndex)
+	}
+
+	return nil
+}
+
+// decodeXML reads an uncompressed XML sitemap or sitemap index.
+func decodeXML(r io.Reader) (*Document, error) {
+	return XMLParser{}.Parse(r)
+}
+
+// walkXML reads an uncompressed XML sitemap or sitemap index and calls fn for
+// every URL it lists.
+//
+// Elements are matched by namespace, so only the elements of the sitemaps
+// protocol and of the image, video, news and xhtml extensions are read, and
+// elements from any other namespace are ignored even if they share a name. In
+// strict mode, a ValidationError is returned if the document doesn't follow
+// the sitemaps protocol, after every URL has been walked, along with the
+// Document, so callers can still follow the children of a sitemap index.
+func walkXML(r io.Reader, fn WalkFunc, strict bool) (*Document, error) {
 	var (
-		urls           = make([]string, 0, AverageSitemapSize)
-		bufferedReader = bufio.NewReader(r)
-		decoder        = xml.NewDecoder(bufferedReader)
-		inURL          = false
-		inImage        = false
+		doc      = &Document{}
+		decoder  = newXMLDecoder(r, strict)
+		rootSeen = false
+		walkErr  error
 	)
 
 	for {
@@ -43,33 +232,91 @@ func Parse(r io.Reader) ([]string, error) {
 			return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
 		}
 
-		switch elem := t.(type) {
-		case xml.StartElement:
-			switch elem.Name.Local {
-			case "url":
-				inURL = true
-			case "image":
-				inImage = true
-			case "loc":
-				if inURL && !inImage {
-					var loc string
-
-					if err := decoder.DecodeElement(&loc, &elem); err != nil {
-						return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
-					}
-
-					urls = append(urls, loc)
-				}
+		root, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if rootSeen {
+			decoder.violate(decoder.line(), "unexpected element <%s> after the root element", root.Name.Local)
+
+			if err := decoder.Skip(); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
 			}
-		case xml.EndElement:
+
+			continue
+		}
+
+		rootSeen = true
+
+		switch {
+		case root.Name.Local != "urlset" && root.Name.Local != "sitemapindex":
+			decoder.violate(decoder.line(), "root element must be <urlset> or <sitemapindex>, not <%s>", root.Name.Local)
+		case root.Name.Space == "":
+			decoder.violate(decoder.line(), "<%s> is missing the %q namespace", root.Name.Local, NamespaceSitemap)
+		case root.Name.Space != NamespaceSitemap:
+			decoder.violate(decoder.line(), "<%s> must be in the %q namespace, not %q", root.Name.Local, NamespaceSitemap, root.Name.Space)
+		}
+
+		doc.index = inSitemapSpace(root.Name) && root.Name.Local == "sitemapindex"
+
+		err = decoder.children(func(elem xml.StartElement) error {
+			if !inSitemapSpace(elem.Name) {
+				return decoder.Skip() //nolint:wrapcheck // Wrapped below.
+			}
+
 			switch elem.Name.Local {
 			case "url":
-				inURL = false
-			case "image":
-				inImage = false
+				if doc.index {
+					decoder.violate(decoder.line(), "unexpected element <url> in <%s>", root.Name.Local)
+				}
+
+				current, err := decoder.decodeURL()
+				if err != nil || current.Loc == "" {
+					return err
+				}
+
+				if err := fn(current); err != nil {
+					walkErr = err
+
+					return err
+				}
+			case "sitemap":
+				if !doc.index {
+					decoder.violate(decoder.line(), "unexpected element <sitemap> in <%s>", root.Name.Local)
+				}
+
+				loc, err := decoder.decodeSitemap()
+				if err != nil {
+					return err
+				}
+
+				if loc != "" {
+					doc.Sitemaps = append(doc.Sitemaps, loc)
+				}
+			default:
+				return decoder.skip(elem, root.Name.Local)
 			}
+
+			return nil
+		})
+
+		if walkErr != nil {
+			return nil, fmt.Errorf("%w", walkErr)
 		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+		}
+	}
+
+	if !rootSeen {
+		decoder.violate(1, "document has no <urlset> or <sitemapindex> root element")
+	}
+
+	if err := decoder.err(); err != nil {
+		return doc, err
 	}
 
-	return urls, nil
+	return doc, nil
 }
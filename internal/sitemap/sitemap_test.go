@@ -4,7 +4,9 @@ import (
 	"errors"
 	"io"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
 )
@@ -54,6 +56,21 @@ func TestParse(t *testing.T) {
 			want:     nil,
 			wantErr:  sitemap.ErrSitemap,
 		},
+		{
+			name:     "sitemap index",
+			fileName: "sitemap-index.xml",
+			want:     nil,
+			wantErr:  sitemap.ErrSitemapIndex,
+		},
+		{
+			name:     "gzip-compressed sitemap",
+			fileName: "gzip-sitemap.xml.gz",
+			want: []string{
+				"http://example.com/page1",
+				"http://example.com/page2",
+			},
+			wantErr: nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -82,7 +99,7 @@ func TestParse(t *testing.T) {
 			}
 
 			for i := range got {
-				if got[i] != tt.want[i] {
+				if got[i].Loc != tt.want[i] {
 					t.Errorf("Parse() got = %v, want %v", got, tt.want)
 
 					return
@@ -92,6 +109,252 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		fileName     string
+		wantIndex    bool
+		wantURLs     []string
+		wantSitemaps []string
+	}{
+		{
+			name:     "valid sitemap",
+			fileName: "valid-sitemap.xml",
+			wantURLs: []string{
+				"http://example.com/page1",
+				"http://example.com/page2",
+			},
+		},
+		{
+			name:      "sitemap index",
+			fileName:  "sitemap-index.xml",
+			wantIndex: true,
+			wantSitemaps: []string{
+				"http://example.com/post-sitemap.xml",
+				"http://example.com/page-sitemap.xml",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := os.Open("testdata/" + tt.fileName)
+			if err != nil {
+				t.Fatalf("could not open test file: %v", err)
+			}
+			defer file.Close()
+
+			got, err := sitemap.Decode(file)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if got.IsIndex() != tt.wantIndex {
+				t.Errorf("Decode() IsIndex() = %v, want %v", got.IsIndex(), tt.wantIndex)
+			}
+
+			if locs := sitemap.Locs(got.URLs); !reflect.DeepEqual(locs, tt.wantURLs) && (len(locs) != 0 || len(tt.wantURLs) != 0) {
+				t.Errorf("Decode() URLs = %v, want %v", locs, tt.wantURLs)
+			}
+
+			if !reflect.DeepEqual(got.Sitemaps, tt.wantSitemaps) {
+				t.Errorf("Decode() Sitemaps = %v, want %v", got.Sitemaps, tt.wantSitemaps)
+			}
+		})
+	}
+}
+
+func TestParse_Images(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.Open("testdata/image-included-sitemap.xml")
+	if err != nil {
+		t.Fatalf("could not open test file: %v", err)
+	}
+	defer file.Close()
+
+	got, err := sitemap.Parse(file)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := [][]sitemap.Image{
+		{{Loc: "http://example.com/image1.jpg"}},
+		nil,
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Parse() got %d URLs, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(got[i].Images, want[i]) {
+			t.Errorf("Parse() URL %d images = %v, want %v", i, got[i].Images, want[i])
+		}
+	}
+}
+
+func TestParse_Extensions(t *testing.T) {
+	t.Parallel()
+
+	file, err := os.Open("testdata/extensions-sitemap.xml")
+	if err != nil {
+		t.Fatalf("could not open test file: %v", err)
+	}
+	defer file.Close()
+
+	got, err := sitemap.Parse(file)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []sitemap.URL{
+		{
+			Loc:      "http://example.com/en/article",
+			Priority: sitemap.DefaultPriority,
+			News: &sitemap.News{
+				PublicationDate:     time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+				PublicationName:     "The Example Times",
+				PublicationLanguage: "en",
+				Title:               "Companies A, B in merger talks",
+			},
+			Images: []sitemap.Image{
+				{
+					Loc:     "http://example.com/photo.jpg",
+					Caption: "A photo",
+					Title:   "Photo",
+				},
+			},
+			Videos: []sitemap.Video{
+				{
+					PublicationDate: time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+					ThumbnailLoc:    "http://example.com/thumb.jpg",
+					Title:           "Grilling steaks",
+					Description:     "How to grill steaks.",
+					ContentLoc:      "http://example.com/video.mp4",
+					Tags:            []string{"steak", "meat"},
+					Duration:        10 * time.Minute,
+					Rating:          4.2,
+					ViewCount:       12345,
+					FamilyFriendly:  false,
+				},
+			},
+			Alternates: []sitemap.Alternate{
+				{Hreflang: "en", Href: "http://example.com/en/article"},
+				{Hreflang: "de", Href: "http://example.com/de/artikel"},
+				{Hreflang: "pt-BR", Href: "http://example.com/pt/artigo"},
+			},
+		},
+		{
+			Loc:      "http://example.com/page2",
+			Priority: sitemap.DefaultPriority,
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParse_Metadata(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		fileName string
+		parser   sitemap.Parser
+		want     []sitemap.URL
+	}{
+		{
+			name:     "xml sitemap",
+			fileName: "metadata-sitemap.xml",
+			parser:   sitemap.XMLParser{},
+			want: []sitemap.URL{
+				{
+					Loc:        "http://example.com/page1",
+					LastMod:    time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+					ChangeFreq: sitemap.ChangeFreqWeekly,
+					Priority:   0.8,
+				},
+				{
+					Loc:      "http://example.com/page2",
+					LastMod:  time.Date(2023, 1, 2, 13, 4, 5, 0, time.UTC),
+					Priority: sitemap.DefaultPriority,
+				},
+			},
+		},
+		{
+			name:     "rss feed",
+			fileName: "rss-feed.xml",
+			parser:   sitemap.RSSParser{},
+			want: []sitemap.URL{
+				{
+					Loc:      "http://example.com/page1",
+					LastMod:  time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+					Priority: sitemap.DefaultPriority,
+				},
+				{
+					Loc:      "http://example.com/page2",
+					Priority: sitemap.DefaultPriority,
+				},
+			},
+		},
+		{
+			name:     "atom feed",
+			fileName: "atom-feed.xml",
+			parser:   sitemap.AtomParser{},
+			want: []sitemap.URL{
+				{
+					Loc:      "http://example.com/page1",
+					LastMod:  time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+					Priority: sitemap.DefaultPriority,
+				},
+				{
+					Loc:      "http://example.com/page2",
+					Priority: sitemap.DefaultPriority,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := os.Open("testdata/" + tt.fileName)
+			if err != nil {
+				t.Fatalf("could not open test file: %v", err)
+			}
+			defer file.Close()
+
+			got, err := tt.parser.Parse(file)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if len(got.URLs) != len(tt.want) {
+				t.Fatalf("Parse() got %d URLs, want %d", len(got.URLs), len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				u := got.URLs[i]
+
+				if u.Loc != want.Loc || !u.LastMod.Equal(want.LastMod) || u.ChangeFreq != want.ChangeFreq || u.Priority != want.Priority {
+					t.Errorf("Parse() URL %d = %+v, want %+v", i, u, want)
+				}
+			}
+		})
+	}
+}
+
 func TestParseLargeSitemap(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,202 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~jamesponddotco/xstd-go/xerrors"
+)
+
+// ErrInvalidSitemap is returned by strict parsers when a sitemap doesn't
+// follow the sitemaps protocol.
+const ErrInvalidSitemap xerrors.Error = "sitemap doesn't follow the sitemaps protocol"
+
+// MaxLocLength is the maximum length of a location allowed by the sitemaps
+// protocol.
+const MaxLocLength = 2048
+
+// maxViolations is the maximum number of violations recorded for a single
+// document, so a broken sitemap can't use unbounded memory.
+const maxViolations = 100
+
+// Violation is a part of an XML sitemap that doesn't follow the sitemaps
+// protocol.
+type Violation struct {
+	// Message describes the violation.
+	Message string
+
+	// Line is the line of the document the violation was found on.
+	Line int
+}
+
+// String returns the violation prefixed with its line number.
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d: %s", v.Line, v.Message)
+}
+
+// ValidationError is returned by strict parsers when a sitemap doesn't follow
+// the sitemaps protocol. It wraps both ErrSitemap and ErrInvalidSitemap.
+type ValidationError struct {
+	// Violations lists the first violations found in the document, in the
+	// order they were found.
+	Violations []Violation
+
+	// Omitted is the number of violations found after the first
+	// maxViolations, which aren't listed.
+	Omitted int
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(ErrSitemap.Error())
+	b.WriteString(": ")
+	b.WriteString(ErrInvalidSitemap.Error())
+
+	for i, v := range e.Violations {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+
+		b.WriteString(v.String())
+	}
+
+	if e.Omitted > 0 {
+		fmt.Fprintf(&b, "; and %d more", e.Omitted)
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the errors wrapped by the ValidationError.
+func (e *ValidationError) Unwrap() []error {
+	return []error{ErrSitemap, ErrInvalidSitemap}
+}
+
+// xmlDecoder decodes XML sitemaps. In strict mode, it records the parts of the
+// document that don't follow the sitemaps protocol as violations.
+type xmlDecoder struct {
+	*xml.Decoder
+
+	violations []Violation
+	omitted    int
+	strict     bool
+}
+
+// newXMLDecoder returns a new xmlDecoder reading from r.
+func newXMLDecoder(r io.Reader, strict bool) *xmlDecoder {
+	return &xmlDecoder{
+		Decoder: xml.NewDecoder(r),
+		strict:  strict,
+	}
+}
+
+// line returns the line of the document the decoder is at.
+func (d *xmlDecoder) line() int {
+	line, _ := d.InputPos()
+
+	return line
+}
+
+// violate records a violation found on the given line. It does nothing
+// outside of strict mode.
+func (d *xmlDecoder) violate(line int, format string, args ...any) {
+	if !d.strict {
+		return
+	}
+
+	if len(d.violations) == maxViolations {
+		d.omitted++
+
+		return
+	}
+
+	d.violations = append(d.violations, Violation{
+		Message: fmt.Sprintf(format, args...),
+		Line:    line,
+	})
+}
+
+// err returns a ValidationError listing the violations found so far, or nil
+// if there are none.
+func (d *xmlDecoder) err() error {
+	if len(d.violations) == 0 {
+		return nil
+	}
+
+	return &ValidationError{
+		Violations: d.violations,
+		Omitted:    d.omitted,
+	}
+}
+
+// once records a violation if the child element of parent named local was
+// already found, and marks it as found otherwise.
+func (d *xmlDecoder) once(seen map[string]bool, parent, local string) {
+	if seen[local] {
+		d.violate(d.line(), "<%s> has more than one <%s>", parent, local)
+	}
+
+	seen[local] = true
+}
+
+// checkLoc records a violation if loc isn't an absolute HTTP or HTTPS URL
+// within the length allowed by the sitemaps protocol.
+func (d *xmlDecoder) checkLoc(line int, elem, loc string) {
+	if !d.strict {
+		return
+	}
+
+	if len(loc) > MaxLocLength {
+		d.violate(line, "<%s> is longer than %d characters", elem, MaxLocLength)
+
+		return
+	}
+
+	parsed, err := url.Parse(loc)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		d.violate(line, "<%s> %q isn't an absolute HTTP or HTTPS URL", elem, loc)
+	}
+}
+
+// checkLastMod records a violation if value isn't a W3C Datetime.
+func (d *xmlDecoder) checkLastMod(line int, elem, value string) {
+	if d.strict && ParseLastMod(value).IsZero() {
+		d.violate(line, "<%s> %q isn't a W3C Datetime", elem, value)
+	}
+}
+
+// checkChangeFreq records a violation if value isn't one of the change
+// frequencies defined by the sitemaps protocol.
+func (d *xmlDecoder) checkChangeFreq(line int, value string) {
+	if !d.strict {
+		return
+	}
+
+	switch ChangeFreq(value) {
+	case ChangeFreqAlways, ChangeFreqHourly, ChangeFreqDaily, ChangeFreqWeekly,
+		ChangeFreqMonthly, ChangeFreqYearly, ChangeFreqNever:
+	default:
+		d.violate(line, "<changefreq> %q isn't always, hourly, daily, weekly, monthly, yearly or never", value)
+	}
+}
+
+// checkPriority records a violation if value isn't a number between 0.0 and
+// 1.0.
+func (d *xmlDecoder) checkPriority(line int, value string) {
+	if !d.strict {
+		return
+	}
+
+	priority, err := strconv.ParseFloat(value, 64)
+	if err != nil || priority < 0 || priority > 1 {
+		d.violate(line, "<priority> %q isn't a number between 0.0 and 1.0", value)
+	}
+}
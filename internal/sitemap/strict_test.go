@@ -0,0 +1,203 @@
+package sitemap_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~jamesponddotco/sitred/internal/sitemap"
+)
+
+func TestXMLParser_Namespaces(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "no namespace",
+			content: `<urlset><url><loc>http://example.com/page1</loc></url></urlset>`,
+			want:    []string{"http://example.com/page1"},
+		},
+		{
+			name:    "legacy namespace",
+			content: `<urlset xmlns="http://www.google.com/schemas/sitemap/0.84"><url><loc>http://example.com/page1</loc></url></urlset>`,
+			want:    []string{"http://example.com/page1"},
+		},
+		{
+			name: "elements in other namespaces",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:c="https://example.com/custom">
+				<url><c:loc>http://example.com/custom</c:loc><loc>http://example.com/page1</loc></url>
+				<c:url><loc>http://example.com/custom</loc></c:url>
+				<url><c:image><loc>http://example.com/page2</loc></c:image></url>
+			</urlset>`,
+			want: []string{"http://example.com/page1"},
+		},
+		{
+			name:    "root in another namespace",
+			content: `<urlset xmlns="https://example.com/custom"><url><loc>http://example.com/page1</loc></url></urlset>`,
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := sitemap.XMLParser{}.Parse(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if locs := sitemap.Locs(got.URLs); !reflect.DeepEqual(locs, tt.want) {
+				t.Errorf("Parse() got = %v, want %v", locs, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLParser_Strict(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []sitemap.Violation
+	}{
+		{
+			name: "valid sitemap",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url>
+    <loc>http://example.com/page1</loc>
+    <lastmod>2023-01-02</lastmod>
+    <changefreq>weekly</changefreq>
+    <priority>0.8</priority>
+    <image:image><image:loc>http://example.com/image.jpg</image:loc></image:image>
+  </url>
+</urlset>`,
+		},
+		{
+			name: "valid sitemap index",
+			content: `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://example.com/sitemap1.xml</loc><lastmod>2023-01-02</lastmod></sitemap>
+</sitemapindex>`,
+		},
+		{
+			name: "missing namespace",
+			content: `<urlset>
+  <url><loc>http://example.com/page1</loc></url>
+</urlset>`,
+			want: []sitemap.Violation{
+				{Line: 1, Message: `<urlset> is missing the "http://www.sitemaps.org/schemas/sitemap/0.9" namespace`},
+			},
+		},
+		{
+			name: "invalid values",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>/page1</loc>
+    <lastmod>yesterday</lastmod>
+    <changefreq>sometimes</changefreq>
+    <priority>1.5</priority>
+  </url>
+</urlset>`,
+			want: []sitemap.Violation{
+				{Line: 3, Message: `<loc> "/page1" isn't an absolute HTTP or HTTPS URL`},
+				{Line: 4, Message: `<lastmod> "yesterday" isn't a W3C Datetime`},
+				{Line: 5, Message: `<changefreq> "sometimes" isn't always, hourly, daily, weekly, monthly, yearly or never`},
+				{Line: 6, Message: `<priority> "1.5" isn't a number between 0.0 and 1.0`},
+			},
+		},
+		{
+			name: "invalid structure",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>http://example.com/page1</loc>
+    <loc>http://example.com/page2</loc>
+    <url><loc>http://example.com/page3</loc></url>
+  </url>
+  <url>
+    <lastmod>2023-01-02</lastmod>
+  </url>
+  <sitemap><loc>http://example.com/sitemap.xml</loc></sitemap>
+</urlset>
+<urlset/>`,
+			want: []sitemap.Violation{
+				{Line: 4, Message: "<url> has more than one <loc>"},
+				{Line: 5, Message: "unexpected element <url> in <url>"},
+				{Line: 7, Message: "<url> is missing <loc>"},
+				{Line: 10, Message: "unexpected element <sitemap> in <urlset>"},
+				{Line: 12, Message: "unexpected element <urlset> after the root element"},
+			},
+		},
+		{
+			name: "invalid extensions",
+			content: `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+  xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+  xmlns:xhtml="http://www.w3.org/1999/xhtml">
+  <url>
+    <loc>http://example.com/page1</loc>
+    <image:image><image:caption>A photo</image:caption></image:image>
+    <xhtml:link rel="alternate" href="http://example.com/de/page1"/>
+  </url>
+</urlset>`,
+			want: []sitemap.Violation{
+				{Line: 6, Message: "<image:image> is missing <image:loc>"},
+				{Line: 7, Message: "alternate <xhtml:link> is missing hreflang or href"},
+			},
+		},
+		{
+			name:    "wrong root element",
+			content: `<rss version="2.0"></rss>`,
+			want: []sitemap.Violation{
+				{Line: 1, Message: "root element must be <urlset> or <sitemapindex>, not <rss>"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := sitemap.XMLParser{Strict: true}.Parse(strings.NewReader(tt.content))
+
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+
+				return
+			}
+
+			var verr *sitemap.ValidationError
+
+			if !errors.As(err, &verr) {
+				t.Fatalf("Parse() error = %v, want a ValidationError", err)
+			}
+
+			if doc == nil {
+				t.Error("Parse() returned no document along with the ValidationError")
+			}
+
+			if !errors.Is(err, sitemap.ErrSitemap) || !errors.Is(err, sitemap.ErrInvalidSitemap) {
+				t.Errorf("Parse() error = %v, want it to wrap %v and %v", err, sitemap.ErrSitemap, sitemap.ErrInvalidSitemap)
+			}
+
+			if !reflect.DeepEqual(verr.Violations, tt.want) {
+				t.Errorf("Parse() violations = %v, want %v", verr.Violations, tt.want)
+			}
+
+			if _, err := (sitemap.XMLParser{}).Parse(strings.NewReader(tt.content)); err != nil {
+				t.Errorf("Parse() in lenient mode error = %v", err)
+			}
+		})
+	}
+}
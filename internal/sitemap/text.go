@@ -0,0 +1,42 @@
+package sitemap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TextParser parses plain text sitemaps, which list one URL per line.
+type TextParser struct{}
+
+// Parse implements the Parser interface. Blank lines are ignored.
+func (p TextParser) Parse(r io.Reader) (*Document, error) {
+	return collect(r, p.Walk)
+}
+
+// Walk implements the Parser interface. Blank lines are ignored.
+func (TextParser) Walk(r io.Reader, fn WalkFunc) (*Document, error) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+
+		err := fn(URL{
+			Loc:      line,
+			Priority: DefaultPriority,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+	}
+
+	return &Document{}, nil
+}